@@ -1,12 +1,19 @@
 package slamdunk
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/fatih/color"
@@ -15,97 +22,844 @@ import (
 // Maps a bucket name to another map of actions and whether they are set
 type Audit map[string]map[string]bool
 
+// Describes whether a bucket could be reached before running the playbook against it.
+type BucketStatus string
+
+const (
+	// bucket exists and allows HeadBucket
+	StatusAccessible BucketStatus = "accessible"
+
+	// bucket exists, but denies HeadBucket and may block everything else
+	StatusForbidden BucketStatus = "exists, access denied"
+
+	// bucket doesn't exist in any region
+	StatusNotFound BucketStatus = "does not exist"
+
+	// bucket couldn't be audited for another reason
+	StatusFailed BucketStatus = "failed"
+
+	// bucket was deliberately excluded from the audit, ie. critical infrastructure that must not be probed
+	StatusSkipped BucketStatus = "skipped"
+)
+
+// Additional information recorded about a bucket during an audit, besides the permissions granted.
+type BucketDetails struct {
+	// region the bucket was audited in
+	Region string
+
+	// prefix that listing and object-level actions were scoped to, if any
+	Prefix string
+
+	// whether the bucket could be reached before auditing
+	Status BucketStatus
+
+	// underlying AWS error code encountered when checking the bucket, if any
+	ErrorCode string
+
+	// explanation of why the bucket couldn't be audited, if it failed
+	Reason string
+
+	// actions that errored out rather than being denied, ie. by timing out
+	Errors map[string]string
+
+	// canonical ID and display name of the bucket's owner, if the ACL could be read
+	OwnerId   string
+	OwnerName string
+
+	// whether S3 considers the bucket public, nil if its policy status couldn't be read
+	Public *bool
+
+	// whether Object Lock (WORM protection) is enabled, nil if its configuration couldn't be read
+	ObjectLock *bool
+
+	// whether server access logging is enabled, nil if its configuration couldn't be read, along with the
+	// bucket and prefix logs are delivered to
+	AccessLoggingEnabled *bool
+	LoggingTarget        string
+	LoggingPrefix        string
+
+	// statements in the bucket policy that grant actions to anyone, if the policy could be read
+	PublicGrants []PublicGrant
+
+	// CORS rules that let any origin modify the bucket, if the CORS configuration could be read
+	PermissiveCors []PermissiveCorsRule
+
+	// URL the bucket is served from as a static website, and whether its index document could be fetched
+	// anonymously, if the website configuration could be read
+	WebsiteEndpoint string
+	WebsiteServing  *bool
+
+	// estimated number of objects and their total size in bytes, if the bucket was listed in a deeper pass
+	ObjectCount *int64
+	TotalSize   *int64
+
+	// keys of objects listed from the bucket, if sampling was enabled and the bucket could be listed
+	SampleKeys []string
+
+	// key listed from the bucket that object-level actions were tested against, if no key was given
+	ListedKey string
+
+	// key, size in bytes and content type of the object whose metadata could be read with `HeadObject`
+	ObjectKey   string
+	ObjectSize  *int64
+	ContentType string
+}
+
+// Default number of pages listed when estimating the size of a bucket
+const DefaultDeepPages = 10
+
+// Default number of read actions run against a bucket at the same time
+const DefaultActionConcurrency = 8
+
 // Represents a single auditor session, where a playbook is constructed from a configuration
 // and applied against single buckets, and bulk results can be outputted.
 type Auditor struct {
-	// name of the IAM profile we're operating on
-	Profile string
+	// credentials and profile we're operating with
+	Config *SessionConfig
+
+	// set if credentials were found for the session
+	Authenticated bool
+
+	// ARN of the IAM principal we're operating as, if authenticated
+	Arn string
 
 	// stores all the actions we care about testing against the buckets
 	Playbook map[string]Action
 
 	// map stores the results for all buckets analyzed in this session
 	Results Audit
-}
 
-// Instantiate a new auditor based on the actions specified. Empty slice means run all.
-func NewAuditor(actions []string, profile string) (*Auditor, error) {
-	log.Println("Parsing out current IAM profile's ARN")
+	// map stores additional information for buckets analyzed in this session
+	Details map[string]*BucketDetails
 
-	// check IAM metadata
-	fmt.Printf("\nYou are: ")
-	if !IsAuthenticated() {
-		color.Red("UNAUTHENTICATED")
-	} else {
-		// get ARN from profile, if not possible then error
-		arn, err := GetIAMUserARN(profile)
-		if err != nil {
-			return nil, err
-		}
-		color.Green(arn)
-	}
-	fmt.Println()
+	// maximum time a single action can run for before being cancelled, no limit if zero
+	Timeout time.Duration
+
+	// key of an object to test object-level actions against, if empty one is listed from each bucket
+	ObjectKey string
 
+	// if set, listing and object-level actions are scoped to keys under this prefix, ie. for multi-tenant buckets
+	Prefix string
+
+	// if set, only these regions are probed when finding a bucket's region
+	Regions []string
+
+	// if set, actions that would be run are recorded instead of calling AWS
+	DryRun bool
+
+	// if non-zero, listable buckets are paginated up to this many pages to estimate their size
+	DeepPages int
+
+	// if non-zero, up to this many object keys are listed from listable buckets and recorded
+	Sample int
+
+	// if set, names that don't resolve in DNS are skipped as nonexistent before calling S3
+	DNSPrefilter bool
+
+	// number of read actions run against a bucket at the same time
+	ActionConcurrency int
+
+	// map stores the actions that would be run against each bucket in a dry run
+	Planned map[string][]string
+
+	// whether write and destructive actions were enabled, checked again before running each action
+	includeWrite       bool
+	includeDestructive bool
+
+	// caches regions found for buckets, and sessions reused for each region
+	regions  map[string]string
+	sessions map[string]*session.Session
+	mu       sync.Mutex
+
+	// guards results and details, so they can be read for output while a bucket is being audited
+	resultsMu sync.Mutex
+}
+
+// Instantiate a new auditor based on the actions specified. Empty slice means run all. Actions that
+// can modify a bucket are excluded unless `includeWrite` is set.
+func NewAuditor(actions []string, includeWrite bool, config *SessionConfig) (*Auditor, error) {
+	return NewAuditorWithPlaybook(NewPlayBook(), actions, includeWrite, false, config)
+}
+
+// Instantiate a new auditor like `NewAuditor`, but selecting actions from a custom playbook, ie. one loaded
+// with `LoadPlaybook`. Destructive actions are excluded unless both `includeWrite` and `includeDestructive` are set.
+func NewAuditorWithPlaybook(playbook PlayBook, actions []string, includeWrite bool, includeDestructive bool, config *SessionConfig) (*Auditor, error) {
 	// if specific actions, clear playbook of those we don't care about
-	log.Println("Creating playbook based on actions to run")
-	playbook := NewPlayBook()
+	Log.Debug("Creating playbook based on actions to run")
 	if len(actions) != 0 {
 		temp := PlayBook{}
+		unknown := []string{}
 		for _, action := range actions {
 			if val, ok := playbook[action]; ok {
 				temp[action] = val
+			} else if suggestion := playbook.Closest(action); suggestion != "" {
+				unknown = append(unknown, fmt.Sprintf("%s (did you mean %s?)", action, suggestion))
+			} else {
+				unknown = append(unknown, action)
 			}
 		}
+
+		// fail fast instead of running an audit that tests nothing
+		if len(unknown) != 0 {
+			return nil, fmt.Errorf("Unknown actions: %s.", strings.Join(unknown, ", "))
+		}
 		playbook = temp
 	}
 
-	results := Audit{}
-	return &Auditor{
-		Profile:  profile,
-		Playbook: playbook,
-		Results:  results,
-	}, nil
+	auditor := &Auditor{
+		Config:             config,
+		Results:            Audit{},
+		Details:            map[string]*BucketDetails{},
+		Planned:            map[string][]string{},
+		ActionConcurrency:  DefaultActionConcurrency,
+		includeWrite:       includeWrite,
+		includeDestructive: includeWrite && includeDestructive,
+		regions:            map[string]string{},
+		sessions:           map[string]*session.Session{},
+	}
+	// remove write and destructive actions if not explicitly enabled
+	for name, action := range playbook {
+		if !auditor.allowed(name, action) {
+			delete(playbook, name)
+		}
+	}
+	auditor.Playbook = playbook
+	return auditor, nil
+}
+
+// Checks if an action is allowed to run based on whether write and destructive actions were enabled.
+func (a *Auditor) allowed(name string, action Action) bool {
+	switch action.Classify(name) {
+	case CategoryWrite:
+		return a.includeWrite
+	case CategoryDestructive:
+		return a.includeDestructive
+	}
+	return true
+}
+
+// Find out who we're auditing as, setting whether we're authenticated and the IAM principal's ARN.
+func (a *Auditor) Identify() error {
+	Log.Debug("Parsing out current IAM profile's ARN")
+
+	// anonymous requests are never authenticated, regardless of credentials available
+	if a.Config.Anonymous {
+		a.Authenticated = false
+		return nil
+	}
+
+	// check IAM metadata, if authenticated get ARN from profile, if not possible then error. When a role is
+	// assumed, resolving credentials assumes it, whatever the base credentials came from, ie. an instance role.
+	_, err := resolveCredentials(a.Config)
+	if err != nil && a.Config.RoleArn != "" {
+		return fmt.Errorf("Cannot assume role %s: %w", a.Config.RoleArn, err)
+	}
+	a.Authenticated = err == nil
+	if a.Authenticated {
+		arn, err := GetIAMUserARN(a.Config)
+		if err != nil {
+			return err
+		}
+		a.Arn = arn
+	}
+	return nil
+}
+
+// Serialized form of an auditor session, used to resume interrupted runs
+type auditorState struct {
+	Profile string `json:"profile"`
+	Results Audit  `json:"results"`
+}
+
+// Write the results gathered so far and the profile used to a filepath as JSON, replacing any previous state
+// atomically so an interrupted run never leaves it truncated.
+func (a *Auditor) SaveState(path string) error {
+	data, err := json.MarshalIndent(auditorState{
+		Profile: a.Config.Profile,
+		Results: a.Snapshot(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Write a file by renaming a temporary one over it, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Restore results from a previous session saved with `SaveState`, merging them into the current ones.
+func (a *Auditor) LoadState(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var state auditorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	if state.Profile != a.Config.Profile {
+		Log.Warnf("State was saved with profile %s, but running with %s\n", state.Profile, a.Config.Profile)
+	}
+	for bucket, audit := range state.Results {
+		a.store(bucket, audit, nil)
+	}
+	return nil
+}
+
+// Safely store the results and details of a bucket, where either is left untouched if nil.
+func (a *Auditor) store(bucket string, audit map[string]bool, details *BucketDetails) {
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+	if audit != nil {
+		a.Results[bucket] = audit
+	}
+	if details != nil {
+		a.Details[bucket] = details
+	}
+}
+
+// Copy the results stored so far, which are safe to read while buckets are still being audited.
+func (a *Auditor) Snapshot() Audit {
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+	audit := Audit{}
+	for bucket, actions := range a.Results {
+		audit[bucket] = actions
+	}
+	return audit
+}
+
+// Copy the details recorded so far, which are safe to read while buckets are still being audited.
+func (a *Auditor) SnapshotDetails() map[string]*BucketDetails {
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+	details := map[string]*BucketDetails{}
+	for bucket, detail := range a.Details {
+		copied := *detail
+		details[bucket] = &copied
+	}
+	return details
+}
+
+// Checks if a bucket already has results stored, ie. from a resumed session.
+func (a *Auditor) Audited(bucket string) bool {
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+	_, ok := a.Results[bucket]
+	return ok
+}
+
+// Record a bucket that failed to be audited with the error encountered, so it still shows up in output.
+func (a *Auditor) Fail(bucket string, err error) {
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+	details, ok := a.Details[bucket]
+	if !ok {
+		details = &BucketDetails{
+			Region:    NoRegion,
+			Status:    StatusFailed,
+			ErrorCode: ErrorCode(err),
+			Errors:    map[string]string{},
+		}
+		a.Details[bucket] = details
+	}
+	details.Reason = err.Error()
+}
+
+// Record a bucket that was excluded from the audit and why, so it still shows up in output.
+func (a *Auditor) Skip(bucket string, reason string) {
+	a.store(bucket, nil, &BucketDetails{
+		Region: NoRegion,
+		Status: StatusSkipped,
+		Reason: reason,
+		Errors: map[string]string{},
+	})
+}
+
+// Find the region a bucket lives in, using the cache if it was already found before.
+func (a *Auditor) region(ctx context.Context, bucket string) (bool, string, error) {
+	a.mu.Lock()
+	region, ok := a.regions[bucket]
+	a.mu.Unlock()
+	if ok {
+		Log.Debugf("Using cached region for %s\n", bucket)
+		return true, region, nil
+	}
+
+	val, region, err := CheckBucketExistsIn(ctx, a.Config, bucket, a.Regions)
+	if val {
+		a.mu.Lock()
+		a.regions[bucket] = region
+		a.mu.Unlock()
+	}
+	return val, region, err
+}
+
+// Use a known region for a bucket instead of discovering it, ie. from a `bucket,region` input line.
+func (a *Auditor) SetRegion(bucket string, region string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.regions[bucket] = region
+}
+
+// Get a session for a region, reusing one if already created.
+func (a *Auditor) session(region string) (*session.Session, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if sess, ok := a.sessions[region]; ok {
+		return sess, nil
+	}
+
+	Log.Debug("Creating new session for", region)
+	sess, err := a.Config.NewSession(region)
+	if err != nil {
+		return nil, err
+	}
+	a.sessions[region] = sess
+	return sess, nil
 }
 
 // Run configured auditor on a single bucket name, and store results in map for output.
 func (a *Auditor) Run(bucket string) error {
+	return a.RunContext(context.Background(), bucket)
+}
+
+// Run configured auditor on a single bucket name until the context is cancelled, ie. on an interrupt. A bucket
+// interrupted partway through has no results stored, so it's audited again when resuming, and the context's
+// error is returned.
+func (a *Auditor) RunContext(ctx context.Context, bucket string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// don't waste calls on names that can't be buckets
+	if !IsValidBucketName(bucket) {
+		return errors.New("Invalid bucket name, does not follow S3 naming rules.")
+	}
+
+	if a.DryRun {
+		a.plan(bucket)
+		return nil
+	}
+
+	// skip names that clearly don't exist without spending any S3 calls
+	if a.DNSPrefilter && !BucketExistsDNS(bucket) {
+		a.store(bucket, nil, &BucketDetails{
+			Region: NoRegion,
+			Status: StatusNotFound,
+			Reason: "name does not resolve in DNS",
+			Errors: map[string]string{},
+		})
+		return errors.New("Specified bucket does not resolve in DNS.")
+	}
 
 	// check first if bucket actually exists
-	log.Println("Checking if bucket exists and finding region")
-	val, region := CheckBucketExists(bucket, NoRegion)
+	Log.Debug("Checking if bucket exists and finding region")
+	val, region, err := a.region(ctx, bucket)
 	if !val {
-		return errors.New("Specified bucket does not exist in any region.")
+		// only report the bucket as missing if S3 said so, rather than when finding it failed for another reason
+		code := ErrorCode(err)
+		missing := err == nil || code == "NotFound" || code == "NoSuchBucket"
+		status := StatusFailed
+		if missing {
+			status = StatusNotFound
+		}
+		a.store(bucket, nil, &BucketDetails{
+			Region:    NoRegion,
+			Status:    status,
+			ErrorCode: code,
+			Errors:    map[string]string{},
+		})
+
+		if err == nil {
+			return errors.New("Specified bucket does not exist in any region.")
+		} else if missing {
+			return fmt.Errorf("Specified bucket does not exist in any region: %w", err)
+		}
+		return fmt.Errorf("Could not check if bucket exists: %w", err)
 	}
-	log.Printf("%s found in %s region\n", bucket, region)
+	Log.Debugf("%s found in %s region\n", bucket, region)
 
-	// initialize session for use with parsed region against all playbook actions
-	log.Println("Creating main session for auditing permissions")
-	sess, _ := session.NewSessionWithOptions(session.Options{
-		Profile: a.Profile,
-		Config: aws.Config{
-			Region: aws.String(region),
-		},
-	})
+	// get session for use with parsed region against all playbook actions
+	Log.Debug("Getting session for auditing permissions")
+	sess, err := a.session(region)
+	if err != nil {
+		return err
+	}
 	svc := s3.New(sess)
 	if svc == nil {
 		return errors.New("Could not instantiate new S3 client")
 	}
 
-	// run all actions specified in our playbook
-	audit := map[string]bool{}
+	// a bucket that exists may still deny everything, so distinguish that from one we can reach
+	details := &BucketDetails{
+		Region: region,
+		Prefix: a.Prefix,
+		Status: StatusAccessible,
+		Errors: map[string]string{},
+	}
+	Log.Debug("Checking if bucket is accessible")
+	actual, err := HeadBucketRegion(ctx, *svc, bucket)
+
+	// a stale region, ie. from a migrated bucket, fails every action as if the bucket were locked down, so
+	// switch to the region S3 reports once and check again
+	if ClassifyHeadError(err, region) == HeadWrongRegion && actual != "" && actual != region {
+		Log.Infof("%s is in %s rather than %s, retrying there\n", bucket, actual, region)
+		region = actual
+		a.SetRegion(bucket, region)
+		sess, err = a.session(region)
+		if err != nil {
+			return err
+		}
+		svc = s3.New(sess)
+		details.Region = region
+		_, err = HeadBucketRegion(ctx, *svc, bucket)
+	}
+	if err != nil {
+		details.ErrorCode = ErrorCode(err)
+		if details.ErrorCode == "Forbidden" || details.ErrorCode == "AccessDenied" {
+			details.Status = StatusForbidden
+		}
+	}
+
+	// run all actions specified in our playbook. Reads are independent so they run concurrently, while
+	// writes run one at a time afterwards, in a stable order, to avoid surprises from them interleaving.
+	target := &Target{
+		Bucket:  bucket,
+		Key:     a.ObjectKey,
+		Prefix:  a.Prefix,
+		Details: details,
+	}
+	reads := []string{}
+	writes := []string{}
 	for name, action := range a.Playbook {
-		log.Printf("Testing %s against %s\n", name, bucket)
-		audit[name] = action.Callback(*svc, bucket)
+		// the playbook may have been changed since the auditor was created, so never trust it to be gated
+		if !a.allowed(name, action) {
+			Log.Warnf("Skipping %s against %s, as it modifies buckets and wasn't enabled\n", name, bucket)
+			continue
+		}
+		if a.isWrite(name) {
+			writes = append(writes, name)
+		} else {
+			reads = append(reads, name)
+		}
+	}
+	sort.Strings(writes)
+
+	audit := map[string]bool{}
+	var mu sync.Mutex
+	run := func(name string) {
+		Log.Debugf("Testing %s against %s\n", name, bucket)
+		result, err := a.runAction(ctx, name, a.Playbook[name], *svc, target)
+		if err != nil {
+			target.Error(name, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		audit[name] = result
+	}
+
+	concurrency := a.ActionConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, name := range reads {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			run(name)
+		}(name)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	a.Results[bucket] = audit
+
+	for _, name := range writes {
+		run(name)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	// estimate how much is actually exposed, which helps prioritize buckets
+	listable := audit["ListObjects"] || audit["ListObjectsV2"]
+	if a.DeepPages != 0 && listable {
+		count, size := EstimateBucketSize(ctx, *svc, bucket, a.Prefix, a.DeepPages)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		details.ObjectCount = &count
+		details.TotalSize = &size
+	}
+	if a.Sample > 0 && listable {
+		details.SampleKeys = SampleObjects(ctx, *svc, bucket, a.Prefix, a.Sample)
+	}
+
+	a.store(bucket, audit, details)
 	return nil
 }
 
-// Output valid permissions directly without instantiating table
-func (a *Auditor) Output() {
-	fmt.Printf("You have permissions for the following buckets:\n\n")
+// Record the actions that would be run against a bucket without making any calls.
+func (a *Auditor) plan(bucket string) {
+	names := []string{}
+	for name, action := range a.Playbook {
+		if a.allowed(name, action) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	a.Planned[bucket] = names
+}
+
+// Write the actions planned in a dry run for each bucket, with their equivalent commands.
+func (a *Auditor) OutputPlan(w io.Writer) {
+	fmt.Fprintf(w, "The following actions would be run:\n\n")
+	name := color.New(color.Bold)
+	details := a.SnapshotDetails()
+	for bucket, actions := range a.Planned {
+		name.Fprintln(w, "* ", bucket)
+		for _, action := range actions {
+			cmd := a.command(a.Playbook[action], bucket, details[bucket])
+			if a.isWrite(action) {
+				color.New(color.FgRed).Fprintf(w, "\t%s: ", action)
+			} else {
+				name.Fprintf(w, "\t%s: ", action)
+			}
+			fmt.Fprintln(w, cmd)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// Helper that builds the concrete `aws s3api` command equivalent to an action against a bucket. Without an
+// object key given, read actions use the key listed from the bucket, while write actions use a probe key so
+// the command never overwrites or deletes a real object.
+func (a *Auditor) command(action Action, bucket string, details *BucketDetails) string {
+	cmd := strings.ReplaceAll(action.Cmd, "<NAME>", bucket)
+	if a.ObjectKey != "" {
+		cmd = strings.ReplaceAll(cmd, "<KEY>", a.ObjectKey)
+	} else if action.Category == CategoryWrite || action.Destructive {
+		cmd = strings.ReplaceAll(cmd, "<KEY>", TempObject)
+	} else if details != nil && details.ListedKey != "" {
+		cmd = strings.ReplaceAll(cmd, "<KEY>", details.ListedKey)
+	}
+	if a.Prefix != "" && strings.HasPrefix(cmd, "list-object") {
+		cmd += " --prefix " + a.Prefix
+	}
+	return "aws s3api " + cmd
+}
+
+// Generate the `aws s3api` commands that reproduce every permission granted per bucket, with the
+// actual bucket name substituted in, so findings can be verified by hand.
+func (a *Auditor) POC() []string {
+	playbook := NewPlayBook()
+	audit, details := a.Snapshot(), a.SnapshotDetails()
+
+	cmds := []string{}
+	for _, bucket := range sortedBuckets(audit) {
+		perms := []string{}
+		for perm, result := range audit[bucket] {
+			if result {
+				perms = append(perms, perm)
+			}
+		}
+		sort.Strings(perms)
+
+		for _, perm := range perms {
+			// results may be loaded from a previous session with actions not in the current playbook
+			action, ok := a.Playbook[perm]
+			if !ok {
+				if action, ok = playbook[perm]; !ok {
+					continue
+				}
+			}
+			cmds = append(cmds, a.command(action, bucket, details[bucket]))
+		}
+	}
+	return cmds
+}
+
+// Checks if an action writes, using its category from the playbook, or from the registry for results
+// loaded from a previous session.
+func (a *Auditor) isWrite(name string) bool {
+	if action, ok := a.Playbook[name]; ok {
+		return action.Classify(name) != CategoryRead
+	}
+	return IsWriteAction(name)
+}
+
+// Create a context bounded by the configured timeout, if any.
+func (a *Auditor) actionContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if a.Timeout != 0 {
+		return context.WithTimeout(parent, a.Timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// Run a single action against a bucket bounded by the configured timeout, returning why it errored if the
+// action was cancelled rather than denied.
+func (a *Auditor) runAction(parent context.Context, name string, action Action, svc s3.S3, target *Target) (bool, error) {
+	ctx, cancel := a.actionContext(parent)
+	defer cancel()
+
+	result := action.Callback(ctx, svc, target)
+	if parent.Err() != nil {
+		return false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		Log.Warnf("%s against %s timed out\n", name, target.Bucket)
+		return false, err
+	}
+	return result, nil
+}
+
+// Summary of how many buckets were found with each kind of access, ie. for deciding an exit code.
+type Findings struct {
+	// buckets allowing any read action
+	Readable int
+
+	// buckets allowing any write action
+	Writable int
+
+	// buckets allowing no actions at all
+	Locked int
+
+	// buckets S3 considers public, or with policy statements granting anything to anyone
+	Public int
+
+	// buckets whose logging configuration could be read and has server access logging disabled
+	LoggingDisabled int
+}
+
+// Summarize the access found across every bucket audited.
+func (a *Auditor) Findings() Findings {
+	findings := Findings{}
+	details := a.SnapshotDetails()
+	for bucket, action := range a.Snapshot() {
+		read, write := false, false
+		for perm, result := range action {
+			if !result {
+				continue
+			}
+			if a.isWrite(perm) {
+				write = true
+			} else {
+				read = true
+			}
+		}
+		if read {
+			findings.Readable += 1
+		}
+		if write {
+			findings.Writable += 1
+		}
+		if !read && !write {
+			findings.Locked += 1
+		}
+		if detail, ok := details[bucket]; ok {
+			if (detail.Public != nil && *detail.Public) || len(detail.PublicGrants) != 0 {
+				findings.Public += 1
+			}
+			if detail.AccessLoggingEnabled != nil && !*detail.AccessLoggingEnabled {
+				findings.LoggingDisabled += 1
+			}
+		}
+	}
+	return findings
+}
+
+// Write a summary of the audit, with how many buckets allow reads or writes and how many allow each action.
+func (a *Auditor) Stats(w io.Writer) {
+	findings := a.Findings()
+	audit := a.Snapshot()
+	tally := map[string]int{}
+	for _, action := range audit {
+		for perm, result := range action {
+			if result {
+				tally[perm] += 1
+			}
+		}
+	}
+
+	// buckets that couldn't be audited only have details recorded
+	var failed, skipped int
+	for bucket, details := range a.SnapshotDetails() {
+		if _, ok := audit[bucket]; ok {
+			continue
+		}
+		if details.Status == StatusSkipped {
+			skipped += 1
+		} else {
+			failed += 1
+		}
+	}
+
+	fmt.Fprintf(w, "\nBuckets Audited: %d\n", len(audit))
+	fmt.Fprintf(w, "Buckets Failed: %d\n", failed)
+	fmt.Fprintf(w, "Buckets Skipped: %d\n\n", skipped)
+	fmt.Fprintf(w, "Buckets With Read Access: %d\n", findings.Readable)
+	fmt.Fprintf(w, "Buckets With Write Access: %d\n", findings.Writable)
+	fmt.Fprintf(w, "Buckets Public: %d\n", findings.Public)
+	fmt.Fprintf(w, "Buckets Without Access Logging: %d\n", findings.LoggingDisabled)
+	fmt.Fprintf(w, "Buckets Locked Down: %d\n\n", findings.Locked)
+
+	perms := []string{}
+	for perm := range tally {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+	for _, perm := range perms {
+		fmt.Fprintf(w, "%s: %d\n", perm, tally[perm])
+	}
+	if len(perms) != 0 {
+		fmt.Fprintln(w)
+	}
+}
+
+// Write valid permissions directly without instantiating table
+func (a *Auditor) Output(w io.Writer) {
+	a.summarize(w, a.Snapshot())
+}
+
+// Write a summary of the permissions granted and details for each bucket, as displayed by `Output`.
+func (a *Auditor) summarize(w io.Writer, audit Audit) {
+	a.resultsMu.Lock()
+	defer a.resultsMu.Unlock()
+
+	fmt.Fprintf(w, "You have permissions for the following buckets:\n\n")
 	name := color.New(color.Bold)
-	for bucket, action := range a.Results {
+	highlight := color.New(color.Bold, color.FgRed)
+	for bucket, action := range audit {
 
 		// stores parsed permissions for each
 		readPerms := []string{}
@@ -116,33 +870,127 @@ func (a *Auditor) Output() {
 				continue
 			}
 
-			// categorize based on name
-			if strings.Contains(perm, "Get") || strings.Contains(perm, "List") {
-				readPerms = append(readPerms, perm)
-			} else if strings.Contains(perm, "Put") {
+			// categorize based on the kind of access tested
+			if a.isWrite(perm) {
 				writePerms = append(writePerms, perm)
+			} else {
+				readPerms = append(readPerms, perm)
 			}
 		}
 		readLen := len(readPerms)
 		writeLen := len(writePerms)
 
-		if readLen == 0 && writeLen == 0 {
+		// actions that couldn't complete, ie. timed out
+		errored := []string{}
+		denied := false
+		if details, ok := a.Details[bucket]; ok {
+			for perm := range details.Errors {
+				errored = append(errored, perm)
+			}
+			denied = details.Status == StatusForbidden
+		}
+
+		if readLen == 0 && writeLen == 0 && len(errored) == 0 && !denied {
 			continue
 		}
 
 		// output information parsed
-		name.Println("* ", bucket)
+		name.Fprintln(w, "* ", bucket)
+
+		if denied {
+			name.Fprintf(w, "\tSTATUS: ")
+			fmt.Fprintf(w, "%s\n", StatusForbidden)
+		}
 
 		if readLen != 0 {
-			name.Printf("\tREAD: ")
-			fmt.Printf("%v\n", readPerms)
+			name.Fprintf(w, "\tREAD: ")
+			fmt.Fprintf(w, "%v\n", readPerms)
 		}
 
 		if writeLen != 0 {
-			name.Printf("\tWRITE: ")
-			fmt.Printf("%v\n", writePerms)
+			name.Fprintf(w, "\tWRITE: ")
+			fmt.Fprintf(w, "%v\n", writePerms)
 		}
 
-		fmt.Println()
+		if len(errored) != 0 {
+			name.Fprintf(w, "\tERRORED: ")
+			fmt.Fprintf(w, "%v\n", errored)
+		}
+
+		if details, ok := a.Details[bucket]; ok {
+			if details.Prefix != "" {
+				name.Fprintf(w, "\tPREFIX: ")
+				fmt.Fprintf(w, "%s\n", details.Prefix)
+			}
+			if details.OwnerId != "" {
+				name.Fprintf(w, "\tOWNER: ")
+				fmt.Fprintf(w, "%s (%s)\n", details.OwnerName, details.OwnerId)
+			}
+			if details.Public != nil {
+				name.Fprintf(w, "\tPUBLIC: ")
+				fmt.Fprintf(w, "%t\n", *details.Public)
+			}
+			if details.ObjectLock != nil {
+				name.Fprintf(w, "\tOBJECT LOCK: ")
+				fmt.Fprintf(w, "%t\n", *details.ObjectLock)
+			}
+			if details.AccessLoggingEnabled != nil {
+				if *details.AccessLoggingEnabled {
+					name.Fprintf(w, "\tACCESS LOGGING: ")
+					fmt.Fprintf(w, "s3://%s/%s\n", details.LoggingTarget, details.LoggingPrefix)
+				} else {
+					highlight.Fprintf(w, "\tACCESS LOGGING: ")
+					fmt.Fprintf(w, "disabled\n")
+				}
+			}
+			if details.WebsiteEndpoint != "" {
+				name.Fprintf(w, "\tWEBSITE: ")
+				if details.WebsiteServing != nil && *details.WebsiteServing {
+					fmt.Fprintf(w, "%s (serving publicly)\n", details.WebsiteEndpoint)
+				} else {
+					fmt.Fprintf(w, "%s\n", details.WebsiteEndpoint)
+				}
+			}
+			if details.ObjectCount != nil {
+				name.Fprintf(w, "\tSIZE: ")
+				fmt.Fprintf(w, "%d objects, %d bytes (up to %d pages listed)\n", *details.ObjectCount, *details.TotalSize, a.DeepPages)
+			}
+			if details.ListedKey != "" {
+				name.Fprintf(w, "\tLISTED KEY: ")
+				fmt.Fprintf(w, "%s\n", details.ListedKey)
+			}
+			if details.ObjectSize != nil {
+				name.Fprintf(w, "\tOBJECT: ")
+				fmt.Fprintf(w, "%s (%d bytes, %s)\n", details.ObjectKey, *details.ObjectSize, details.ContentType)
+			}
+			if len(details.SampleKeys) != 0 {
+				name.Fprintf(w, "\tSAMPLE: ")
+				fmt.Fprintf(w, "%v\n", details.SampleKeys)
+			}
+			for _, grant := range details.PublicGrants {
+				name.Fprintf(w, "\tPUBLIC POLICY: ")
+				fmt.Fprintf(w, "%v on %v", grant.Actions, grant.Resources)
+				if grant.Conditional {
+					fmt.Fprintf(w, " (conditional)")
+				}
+				fmt.Fprintln(w)
+			}
+			for _, rule := range details.PermissiveCors {
+				highlight.Fprintf(w, "\tPERMISSIVE CORS: ")
+				fmt.Fprintf(w, "%v from %v\n", rule.AllowedMethods, rule.AllowedOrigins)
+			}
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	// buckets that couldn't be audited at all
+	for bucket, details := range a.Details {
+		if _, ok := audit[bucket]; ok {
+			continue
+		}
+		name.Fprintln(w, "* ", bucket)
+		name.Fprintf(w, "\tSTATUS: ")
+		fmt.Fprintf(w, "%s (%s)\n\n", details.Status, details.Reason)
 	}
 }
@@ -0,0 +1,157 @@
+package slamdunk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCommandKey(t *testing.T) {
+	playbook := NewPlayBook()
+	auditor := &Auditor{}
+	details := map[string]*BucketDetails{
+		"listed-bucket": {ListedKey: "reports/2021.csv"},
+	}
+
+	tests := []struct {
+		action string
+		bucket string
+		want   string
+	}{
+		{"GetObject", "listed-bucket", "aws s3api get-object --bucket listed-bucket --key reports/2021.csv <OUTFILE>"},
+		{"HeadObject", "listed-bucket", "aws s3api head-object --bucket listed-bucket --key reports/2021.csv"},
+		{"DeleteObject", "listed-bucket", "aws s3api delete-object --bucket listed-bucket --key " + TempObject},
+		{"GetObject", "empty-bucket", "aws s3api get-object --bucket empty-bucket --key <KEY> <OUTFILE>"},
+	}
+	for _, test := range tests {
+		if got := auditor.command(playbook[test.action], test.bucket, details[test.bucket]); got != test.want {
+			t.Errorf("command(%s, %s) = %q, want %q", test.action, test.bucket, got, test.want)
+		}
+	}
+
+	auditor.ObjectKey = "given.txt"
+	want := "aws s3api get-object --bucket listed-bucket --key given.txt <OUTFILE>"
+	if got := auditor.command(playbook["GetObject"], "listed-bucket", details["listed-bucket"]); got != want {
+		t.Errorf("command with object key = %q, want %q", got, want)
+	}
+}
+
+// Output must be safe to generate while buckets are still being audited, ie. for progress or on an interrupt.
+func TestOutputWhileAuditing(t *testing.T) {
+	auditor := &Auditor{
+		Results:  Audit{},
+		Details:  map[string]*BucketDetails{},
+		Playbook: NewPlayBook(),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			bucket := fmt.Sprintf("bucket-%d", i)
+			auditor.store(bucket, map[string]bool{"GetObject": true}, &BucketDetails{ListedKey: "a.txt"})
+			auditor.Fail(fmt.Sprintf("failed-%d", i), fmt.Errorf("timed out"))
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		auditor.Stats(ioutil.Discard)
+		auditor.Metrics()
+		auditor.POC()
+		auditor.Notification()
+		if _, err := NewHTMLReport(auditor.Snapshot(), auditor.SnapshotDetails()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if findings := auditor.Findings(); findings.Readable != 100 {
+		t.Errorf("found %d readable buckets, want 100", findings.Readable)
+	}
+}
+
+// A role that can't be assumed must fail loudly, rather than auditing as an unauthenticated user.
+func TestIdentifyRole(t *testing.T) {
+	isolateCredentials(t)
+
+	auditor := &Auditor{Config: &SessionConfig{}}
+	if err := auditor.Identify(); err != nil || auditor.Authenticated {
+		t.Errorf("Identify() = %v with authenticated %t, want no error and unauthenticated", err, auditor.Authenticated)
+	}
+
+	auditor = &Auditor{Config: &SessionConfig{RoleArn: "arn:aws:iam::111122223333:role/audit"}}
+	if err := auditor.Identify(); err == nil || !strings.Contains(err.Error(), "arn:aws:iam::111122223333:role/audit") {
+		t.Errorf("Identify() = %v, want an error naming the role", err)
+	}
+}
+
+// Saving state must replace the file in one step, so a run interrupted while saving, or a reader racing it,
+// only ever sees a complete state file.
+func TestSaveStateAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slamdunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	auditor := &Auditor{
+		Config:   &SessionConfig{Profile: "audit"},
+		Results:  Audit{},
+		Details:  map[string]*BucketDetails{},
+		Playbook: NewPlayBook(),
+	}
+	if err := auditor.SaveState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 200; i++ {
+			auditor.store(fmt.Sprintf("bucket-%d", i), map[string]bool{"GetObject": true}, nil)
+			if err := auditor.SaveState(path); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	for saving := true; saving; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			saving = false
+		default:
+		}
+
+		restored := &Auditor{Config: &SessionConfig{Profile: "audit"}, Results: Audit{}}
+		if err := restored.LoadState(path); err != nil {
+			t.Fatalf("read a partially written state file: %v", err)
+		}
+	}
+
+	// a failed save leaves nothing behind next to the state file
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditor.SaveState(path); err == nil {
+		t.Error("saved state over a directory")
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("found %d files after a failed save, want only the blocking directory", len(entries))
+	}
+}
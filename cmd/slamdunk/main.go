@@ -2,15 +2,22 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"os/signal"
+	"path"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/ex0dus-0x/slamdunk"
+	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli/v2"
 )
@@ -24,15 +31,96 @@ func ReadLines(path string) (*[]string, error) {
 	}
 	defer file.Close()
 
-	// read path into lines
+	// read path into lines, skipping blank ones
 	var lines []string
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			lines = append(lines, line)
+		}
 	}
 	return &lines, scanner.Err()
 }
 
+// Helper that normalizes bucket names, ie. stripping `s3://` prefixes, and removes duplicates.
+func NormalizeBuckets(names []string) []string {
+	seen := map[string]bool{}
+	buckets := []string{}
+	for _, name := range names {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "s3://")
+		name = strings.SplitN(name, "/", 2)[0]
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		buckets = append(buckets, name)
+	}
+	return buckets
+}
+
+// Helper that splits out regions given alongside bucket names as `bucketname,region`, returning the names
+// and the regions given for them.
+func SplitBucketRegions(lines []string) ([]string, map[string]string) {
+	names := []string{}
+	regions := map[string]string{}
+	for _, line := range lines {
+		parts := strings.SplitN(line, ",", 2)
+		name := strings.TrimSpace(parts[0])
+		names = append(names, name)
+		if len(parts) == 2 {
+			if region := strings.TrimSpace(parts[1]); region != "" {
+				bucket := strings.SplitN(strings.TrimPrefix(name, "s3://"), "/", 2)[0]
+				regions[bucket] = region
+			}
+		}
+	}
+	return names, regions
+}
+
+// Helper that splits comma-separated values given to a repeatable flag, ie. `--regions us-east-1,eu-west-1`,
+// trimming whitespace and dropping empty values.
+func SplitCommas(values []string) []string {
+	split := []string{}
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				split = append(split, part)
+			}
+		}
+	}
+	return split
+}
+
+// Helper that finds the first glob pattern, ie. `prod-*`, that a bucket name matches, if any.
+func MatchPattern(name string, patterns []string) (string, bool) {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// Helper that removes duplicate URLs, treating ones that only differ by protocol as the same.
+func NormalizeUrls(urls []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, url := range urls {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		_, relativeUrl := slamdunk.GenerateUrlPair(url)
+		if seen[relativeUrl] {
+			continue
+		}
+		seen[relativeUrl] = true
+		normalized = append(normalized, url)
+	}
+	return normalized
+}
+
 // Helper to render and output an ASCII table
 func PrintTable(header []string, content [][]string) {
 	table := tablewriter.NewWriter(os.Stdout)
@@ -44,6 +132,99 @@ func PrintTable(header []string, content [][]string) {
 	table.Render()
 }
 
+// Create a context cancelled on the first Ctrl+C or SIGTERM, so work in flight can finish before results are
+// output. Handling stops after the first signal, so a second one terminates immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	slamdunk.Log.Debug("Installing signal handler to handle interrupts")
+	ctx, cancel := context.WithCancel(context.Background())
+	channel := make(chan os.Signal, 1)
+	signal.Notify(channel, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-channel:
+			slamdunk.Log.Debug("Ctrl+C pressed, finishing work in flight...")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(channel)
+	}()
+	return ctx, cancel
+}
+
+// Lightweight counter updated in place on stderr during long runs, so it doesn't interfere with output on stdout.
+type Progress struct {
+	verb     string
+	noun     string
+	total    int
+	count    int
+	disabled bool
+	mu       sync.Mutex
+}
+
+// Create a new progress counter, ie. `Audited 142/5000 buckets...`. Nothing is written if disabled.
+func NewProgress(verb string, noun string, total int, disabled bool) *Progress {
+	return &Progress{
+		verb:     verb,
+		noun:     noun,
+		total:    total,
+		disabled: disabled,
+	}
+}
+
+// Count another item as done and redraw the counter.
+func (p *Progress) Incr() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count++
+	if !p.disabled {
+		fmt.Fprintf(os.Stderr, "\r%s %d/%d %s...", p.verb, p.count, p.total, p.noun)
+	}
+}
+
+// Finish the counter's line so that anything written afterwards starts on a new one.
+func (p *Progress) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.disabled && p.count != 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	p.disabled = true
+}
+
+// Helper that checks if logging was enabled, either with `--verbose` or a log level.
+func Logging(c *cli.Context) bool {
+	return c.Bool("verbose") || c.String("log-level") != ""
+}
+
+// Helper that configures the logger from the global flags, staying quiet unless logging was enabled.
+func ConfigureLogging(c *cli.Context) error {
+	var out io.Writer = ioutil.Discard
+	if Logging(c) {
+		out = os.Stderr
+	}
+
+	level := slamdunk.LevelDebug
+	if name := c.String("log-level"); name != "" {
+		parsed, err := slamdunk.ParseLogLevel(name)
+		if err != nil {
+			return err
+		}
+		level = parsed
+	}
+	slamdunk.Log = slamdunk.NewLogger(out, level, c.Bool("log-json"))
+	return nil
+}
+
+// Exit codes used when findings are configured to fail a run, ie. for CI gating
+const (
+	ExitRead     = 2
+	ExitWrite    = 3
+	ExitTakeover = 4
+)
+
+// Most buckets audited in one run unless raised, so a huge input list doesn't flood AWS with calls by accident
+const DefaultMaxBuckets = 1000
+
 func main() {
 	app := &cli.App{
 		Name:  "slamdunk",
@@ -54,6 +235,53 @@ func main() {
 				Usage:   "If set, will print out log for debugging.",
 				Aliases: []string{"v"},
 			},
+			&cli.StringFlag{
+				Name:  "log-level",
+				Usage: "Minimum level of log messages printed, one of error, warn, info or debug. Enables logging without --verbose.",
+			},
+			&cli.BoolFlag{
+				Name:  "log-json",
+				Usage: "If set, log messages are printed as lines of JSON.",
+			},
+			&cli.BoolFlag{
+				Name:  "dualstack",
+				Usage: "If set, S3 is reached through dualstack endpoints, ie. on IPv6-only networks.",
+			},
+			&cli.StringFlag{
+				Name:  "proxy",
+				Usage: "HTTP or SOCKS5 proxy that every request is sent through, ie. socks5://127.0.0.1:1080.",
+			},
+			&cli.BoolFlag{
+				Name:  "insecure",
+				Usage: "If set, TLS certificates aren't verified, ie. for self-hosted stores with self-signed certificates.",
+			},
+			&cli.StringFlag{
+				Name:  "user-agent",
+				Usage: "User agent sent with every request, instead of the defaults of Go and the AWS SDK.",
+			},
+			&cli.StringFlag{
+				Name:  "region",
+				Usage: "Default region for sessions when a bucket's region isn't known, ie. for other partitions like cn-north-1.",
+				Value: slamdunk.GlobalRegion,
+			},
+			&cli.StringFlag{
+				Name:  "credentials-file",
+				Usage: "Path to the shared AWS credentials file, instead of ~/.aws/credentials.",
+			},
+			&cli.StringFlag{
+				Name:  "config-file",
+				Usage: "Path to the shared AWS config file, instead of ~/.aws/config.",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			slamdunk.DualStack = c.Bool("dualstack")
+			slamdunk.DefaultRegion = c.String("region")
+			slamdunk.UserAgent = c.String("user-agent")
+			if c.Bool("insecure") {
+				color.Yellow("WARNING: TLS certificates aren't verified, so responses can be forged by anyone intercepting traffic.")
+				slamdunk.SetInsecure(true)
+			}
+			return slamdunk.SetProxy(c.String("proxy"))
 		},
 		Commands: []*cli.Command{
 			{
@@ -68,19 +296,27 @@ func main() {
 					},
 					&cli.StringFlag{
 						Name:    "file",
-						Usage:   "File with multiple target bucket names to audit.",
+						Usage:   "File with multiple target bucket names to audit, one per line. Lines can be bucketname,region to skip finding the region.",
 						Aliases: []string{"f"},
 					},
 					&cli.BoolFlag{
 						Name:    "list",
-						Usage:   "Get buckets that can be listed for the given scoped IAM principal, if ListBucket is allowed.",
-						Aliases: []string{"l"},
+						Usage:   "Audit every bucket owned by the given scoped IAM principal, if ListBucket is allowed.",
+						Aliases: []string{"l", "all", "self"},
 					},
 					&cli.StringSliceFlag{
 						Name:    "perm",
 						Usage:   "Runs only specified permission against buckets. Can be invoked multiple times.",
 						Aliases: []string{"p"},
 					},
+					&cli.BoolFlag{
+						Name:  "allow-destructive",
+						Usage: "Also run actions that actually modify buckets if allowed, ie. DeleteBucketPolicy. Requires --write.",
+					},
+					&cli.StringFlag{
+						Name:  "playbook",
+						Usage: "YAML or JSON file listing the built-in actions to run, instead of the whole playbook.",
+					},
 					&cli.BoolFlag{
 						Name:    "write",
 						Usage:   "Run checks on WRITE permissions (WARNING: may alter content/configurations of configuration resources).",
@@ -93,22 +329,162 @@ func main() {
 						DefaultText: "default",
 						Aliases:     []string{"i"},
 					},
+					&cli.BoolFlag{
+						Name:  "anonymous",
+						Usage: "Send requests without any credentials, to audit what an unauthenticated user can access. Same as using the 'none' profile.",
+					},
+					&cli.StringFlag{
+						Name:  "role-arn",
+						Usage: "ARN of an IAM role to assume with the profile's credentials before auditing, ie. for cross-account audits.",
+					},
+					&cli.StringFlag{
+						Name:  "external-id",
+						Usage: "External ID to pass when assuming the role specified with --role-arn.",
+					},
+					&cli.StringFlag{
+						Name:  "object-key",
+						Usage: "Key of an object to test object-level permissions against. If not set, the first listable object is used.",
+					},
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "Only list and test objects under this prefix, ie. for buckets partitioned by tenant.",
+					},
+					&cli.DurationFlag{
+						Name:    "timeout",
+						Usage:   "Maximum time a single action can run against a bucket before being cancelled, or 0 for no limit.",
+						Value:   10 * time.Second,
+						Aliases: []string{"t"},
+					},
+					&cli.IntFlag{
+						Name:  "max-retries",
+						Usage: "Maximum number of times throttled requests are retried with exponential backoff.",
+						Value: slamdunk.MaxRetries,
+					},
+					&cli.IntFlag{
+						Name:  "rate",
+						Usage: "Maximum number of requests sent per second, or 0 for no limit.",
+					},
+					&cli.StringSliceFlag{
+						Name:  "regions",
+						Usage: "Comma-separated regions to probe for buckets in, instead of discovering each bucket's region.",
+					},
+					&cli.BoolFlag{
+						Name:  "deep",
+						Usage: "Estimate the number of objects and total size of buckets that can be listed.",
+					},
+					&cli.IntFlag{
+						Name:  "sample",
+						Usage: "Number of object keys to list and display from buckets that can be listed, or 0 for none.",
+					},
+					&cli.BoolFlag{
+						Name:  "dns-prefilter",
+						Usage: "Skip buckets whose names don't resolve in DNS before calling S3.",
+					},
+					&cli.StringSliceFlag{
+						Name:  "skip",
+						Usage: "Bucket name or glob pattern, ie. terraform-state-*, excluded from the audit. Can be invoked multiple times.",
+					},
+					&cli.StringFlag{
+						Name:  "skip-file",
+						Usage: "File with bucket names or glob patterns excluded from the audit, one per line.",
+					},
+					&cli.IntFlag{
+						Name:  "max-buckets",
+						Usage: "Refuse to run if more than this many buckets are given, or 0 for no limit.",
+						Value: DefaultMaxBuckets,
+					},
+					&cli.IntFlag{
+						Name:  "action-concurrency",
+						Usage: "Number of read actions to run against a bucket at the same time. Writes always run one at a time.",
+						Value: slamdunk.DefaultActionConcurrency,
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Print the actions that would be run against each bucket without calling AWS.",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Format results are output in, one of table, json, csv or markdown.",
+						Value: slamdunk.FormatTable,
+					},
+					&cli.StringFlag{
+						Name:  "html",
+						Usage: "Path where a standalone HTML report of the permissions granted on each bucket is stored.",
+					},
+					&cli.StringFlag{
+						Name:  "output-dir",
+						Usage: "Directory where a JSON file with the permissions and details of each bucket is stored, created if missing.",
+					},
+					&cli.StringFlag{
+						Name:  "metrics-file",
+						Usage: "Path where Prometheus metrics for the findings are stored, ie. for the node_exporter textfile collector.",
+					},
+					&cli.StringFlag{
+						Name:  "webhook",
+						Usage: "URL a JSON summary of the findings is posted to when done, ie. a Slack incoming webhook.",
+					},
+					&cli.StringFlag{
+						Name:  "sarif",
+						Usage: "Path where permissions granted are stored as a SARIF document, ie. for GitHub code scanning.",
+					},
+					&cli.BoolFlag{
+						Name:  "poc",
+						Usage: "Print the aws CLI commands that reproduce every permission granted, for verifying findings.",
+					},
+					&cli.BoolFlag{
+						Name:  "no-progress",
+						Usage: "Don't display a progress counter on stderr while running.",
+					},
+					&cli.StringSliceFlag{
+						Name:  "fail-on",
+						Usage: "Exit with a non-zero code if any bucket allows read (or is public) or write access. One of read or write, can be invoked multiple times.",
+					},
+					&cli.StringFlag{
+						Name:    "resume",
+						Usage:   "Path to a state file that results are saved to, and that is used to skip buckets already audited.",
+						Aliases: []string{"r"},
+					},
 				},
 				Action: func(c *cli.Context) error {
-					if !c.Bool("verbose") {
-						log.SetOutput(ioutil.Discard)
+					if err := ConfigureLogging(c); err != nil {
+						return err
 					}
-					log.Printf("Starting slamdunk.")
+					slamdunk.Log.Debugf("Starting slamdunk.")
 
-					// IAM profile check
+					// IAM profile check, where no profile means sending anonymous requests
 					profile := c.String("profile")
+					anonymous := c.Bool("anonymous")
 					if profile == "none" {
 						profile = ""
+						anonymous = true
+					}
+					if anonymous {
+						if c.String("role-arn") != "" {
+							return errors.New("Cannot assume a role with `--role-arn` when auditing anonymously.")
+						}
+						if c.Bool("list") {
+							return errors.New("Cannot use `--list` when auditing anonymously, as listing buckets requires credentials.")
+						}
+						slamdunk.Log.Debug("Auditing anonymously without credentials")
+					} else {
+						slamdunk.Log.Debug("Using IAM profile", profile)
+					}
+
+					// configure retries and rate limiting shared by every session
+					slamdunk.MaxRetries = c.Int("max-retries")
+					slamdunk.SetRateLimit(c.Int("rate"))
+
+					config := &slamdunk.SessionConfig{
+						Profile:         profile,
+						RoleArn:         c.String("role-arn"),
+						ExternalId:      c.String("external-id"),
+						Anonymous:       anonymous,
+						CredentialsFile: c.String("credentials-file"),
+						ConfigFile:      c.String("config-file"),
 					}
-					log.Println("Using IAM profile", profile)
 
 					// argparse out buckets to test
-					log.Println("Argparsing for bucket names to audit")
+					slamdunk.Log.Debug("Argparsing for bucket names to audit")
 					names := c.StringSlice("name")
 					file := c.String("file")
 					list := c.Bool("list")
@@ -125,49 +501,253 @@ func main() {
 						names = append(names, *vals...)
 					}
 
+					// listing buckets requires calling AWS
+					dryRun := c.Bool("dry-run")
+					if dryRun && list {
+						return errors.New("Cannot use `--list` with `--dry-run`, as listing buckets calls AWS.")
+					}
+
 					// if `--list` is set, grab buckets for current IAM principal, otherwise exit if denied
 					if list {
-						log.Println("Checking if we can parse buckets with ListBucket")
-						listed, err := slamdunk.ListBuckets(profile)
+						slamdunk.Log.Debug("Checking if we can parse buckets with ListBucket")
+						listed, err := slamdunk.ListBuckets(config)
 						if err != nil {
 							return err
 						}
+						if len(*listed) == 0 {
+							slamdunk.Log.Warn("No buckets could be listed for the current IAM principal.")
+						}
 						names = append(names, *listed...)
 					}
 
-					log.Printf("Parsed out %d buckets for testing\n", len(names))
+					// regions may be given alongside names, which skips discovering them
+					names, knownRegions := SplitBucketRegions(names)
+					names = NormalizeBuckets(names)
+					if len(names) == 0 {
+						return nil
+					}
+					slamdunk.Log.Debugf("Parsed out %d buckets for testing\n", len(names))
+
+					// exclude buckets that must never be probed before anything is called against them
+					patterns := c.StringSlice("skip")
+					if skipFile := c.String("skip-file"); skipFile != "" {
+						vals, err := ReadLines(skipFile)
+						if err != nil {
+							return err
+						}
+						patterns = append(patterns, *vals...)
+					}
+					for _, pattern := range patterns {
+						if _, err := path.Match(pattern, ""); err != nil {
+							return fmt.Errorf("Invalid pattern %s for `--skip`: %s", pattern, err)
+						}
+					}
+					skipped := map[string]string{}
+					targets := []string{}
+					for _, name := range names {
+						if pattern, ok := MatchPattern(name, patterns); ok {
+							slamdunk.Log.Debugf("Skipping %s, matches %s\n", name, pattern)
+							skipped[name] = pattern
+							continue
+						}
+						targets = append(targets, name)
+					}
+					names = targets
+
+					// guard against accidentally auditing a huge list, which costs money and gets throttled
+					if max := c.Int("max-buckets"); max > 0 && len(names) > max {
+						return fmt.Errorf("Refusing to audit %d buckets, more than `--max-buckets` %d. Raise it or set it to 0 to audit them all.", len(names), max)
+					}
 
 					// parse specific actions
 					actions := []string{}
 					if len(c.StringSlice("perm")) != 0 {
 						actions = c.StringSlice("perm")
 					}
-                    log.Println("Running actions", actions);
+                    slamdunk.Log.Debug("Running actions", actions);
 
 					// audit each bucket and handle accordingly
-					auditor, err := slamdunk.NewAuditor(actions, profile)
+					playbook := slamdunk.NewPlayBook()
+					if path := c.String("playbook"); path != "" {
+						slamdunk.Log.Debug("Loading playbook from", path)
+						loaded, err := slamdunk.LoadPlaybook(path)
+						if err != nil {
+							return err
+						}
+						playbook = loaded
+					}
+					if c.Bool("allow-destructive") && !c.Bool("write") {
+						return errors.New("Cannot use `--allow-destructive` without `--write`.")
+					}
+					auditor, err := slamdunk.NewAuditorWithPlaybook(playbook, actions, c.Bool("write"), c.Bool("allow-destructive"), config)
+					if err != nil {
+						return err
+					}
+
+					auditor.DryRun = dryRun
+
+					// findings that should fail the run, checked before doing anything
+					failRead, failWrite := false, false
+					for _, finding := range c.StringSlice("fail-on") {
+						switch finding {
+						case "read":
+							failRead = true
+						case "write":
+							failWrite = true
+						case "takeover":
+							return errors.New("Takeovers are only found by `resolve`, use `--fail-on-takeover` with it instead.")
+						default:
+							return errors.New("Unsupported finding for `--fail-on`, must be one of read or write.")
+						}
+					}
+
+					// select how results are output, both at the end and when interrupted
+					format := c.String("format")
+					renderer, err := auditor.Renderer(format)
 					if err != nil {
 						return err
 					}
+					render := func() error {
+						data, err := renderer.Render(auditor.Snapshot())
+						if err != nil {
+							return err
+						}
+						_, err = os.Stdout.Write(data)
+						return err
+					}
+
+					// display who we're auditing as, keeping other formats clean for piping
+					if !dryRun {
+						if err := auditor.Identify(); err != nil {
+							return err
+						}
+						if format == slamdunk.FormatTable {
+							fmt.Printf("\nYou are: ")
+							if !auditor.Authenticated {
+								color.Red("UNAUTHENTICATED")
+							} else {
+								color.Green(auditor.Arn)
+							}
+							fmt.Println()
+						}
+					}
+
+					for bucket, region := range knownRegions {
+						auditor.SetRegion(bucket, region)
+					}
+					for bucket, pattern := range skipped {
+						auditor.Skip(bucket, fmt.Sprintf("matches skip pattern %s", pattern))
+					}
+					auditor.Timeout = c.Duration("timeout")
+					auditor.ObjectKey = c.String("object-key")
+					auditor.Prefix = c.String("prefix")
+					auditor.Regions = SplitCommas(c.StringSlice("regions"))
+					if c.Bool("deep") {
+						auditor.DeepPages = slamdunk.DefaultDeepPages
+					}
+					auditor.Sample = c.Int("sample")
+					auditor.DNSPrefilter = c.Bool("dns-prefilter")
+					auditor.ActionConcurrency = c.Int("action-concurrency")
+
+					// if resuming, load up results from a previous session if one was saved
+					statePath := c.String("resume")
+					if statePath != "" {
+						if _, err := os.Stat(statePath); err == nil {
+							slamdunk.Log.Debug("Loading previous state from", statePath)
+							if err := auditor.LoadState(statePath); err != nil {
+								return err
+							}
+						}
+					}
 
-					// handle keyboard interrupts to output table with content so far
-					log.Println("Installing signal handler to handle interrupts")
-					channel := make(chan os.Signal)
-					signal.Notify(channel, os.Interrupt, syscall.SIGTERM)
-					go func() {
-						<-channel
-						log.Println("Ctrl+C pressed, interrupting execution...")
-						os.Exit(0)
-					}()
+					// handle keyboard interrupts by stopping after the bucket being audited, and outputting content so far
+					ctx, cancel := interruptContext()
+					defer cancel()
+					progress := NewProgress("Audited", "buckets", len(names), c.Bool("no-progress") || Logging(c))
 
 					for _, bucket := range names {
-						log.Printf("Auditing %s...\n", bucket)
-						if err := auditor.Run(bucket); err != nil {
+						if ctx.Err() != nil {
+							break
+						}
+						if auditor.Audited(bucket) {
+							slamdunk.Log.Debugf("Skipping %s, already audited\n", bucket)
+							progress.Incr()
+							continue
+						}
+
+						slamdunk.Log.Infof("Auditing %s...\n", bucket)
+						if err := auditor.RunContext(ctx, bucket); err != nil {
+							if ctx.Err() != nil {
+								break
+							}
+							slamdunk.Log.Error(err)
+							auditor.Fail(bucket, err)
+							progress.Incr()
+							continue
+						}
+						progress.Incr()
+
+						// checkpoint after every bucket so a crash doesn't lose progress
+						if statePath != "" && !dryRun {
+							if err := auditor.SaveState(statePath); err != nil {
+								return err
+							}
+						}
+					}
+					progress.Done()
+
+					if dryRun {
+						auditor.OutputPlan(color.Output)
+						return nil
+					}
+
+					if err := render(); err != nil {
+						return err
+					}
+					if format == slamdunk.FormatTable {
+						auditor.Stats(os.Stdout)
+					}
+					if c.Bool("poc") {
+						fmt.Printf("Proof-of-concept commands:\n\n")
+						for _, cmd := range auditor.POC() {
+							fmt.Println(cmd)
+						}
+						fmt.Println()
+					}
+					if htmlPath := c.String("html"); htmlPath != "" {
+						if err := auditor.OutputHTML(htmlPath); err != nil {
+							return err
+						}
+					}
+					if sarifPath := c.String("sarif"); sarifPath != "" {
+						if err := auditor.OutputSARIF(sarifPath); err != nil {
 							return err
 						}
 					}
+					if outputDir := c.String("output-dir"); outputDir != "" {
+						if err := auditor.OutputDir(outputDir); err != nil {
+							return err
+						}
+					}
+					if metricsPath := c.String("metrics-file"); metricsPath != "" {
+						if err := auditor.OutputMetrics(metricsPath); err != nil {
+							return err
+						}
+					}
+					if webhook := c.String("webhook"); webhook != "" {
+						if err := slamdunk.Notify(webhook, auditor.Notification()); err != nil {
+							color.Yellow("WARNING: couldn't notify webhook: %s", err)
+						}
+					}
 
-					auditor.Output()
+					// fail on the most severe finding configured
+					findings := auditor.Findings()
+					if failWrite && findings.Writable != 0 {
+						return cli.Exit(fmt.Sprintf("Found %d buckets with write access.", findings.Writable), ExitWrite)
+					}
+					if failRead && (findings.Readable != 0 || findings.Public != 0) {
+						return cli.Exit(fmt.Sprintf("Found %d buckets with read access and %d public.", findings.Readable, findings.Public), ExitRead)
+					}
 					return nil
 				},
 			},
@@ -191,17 +771,95 @@ func main() {
 						Aliases: []string{"m"},
 						Value:   true,
 					},
+					&cli.BoolFlag{
+						Name:  "fail-on-takeover",
+						Usage: "Exit with a non-zero code if any bucket is vulnerable to takeover.",
+					},
+					&cli.BoolFlag{
+						Name:  "dedupe",
+						Usage: "Display only the first URL resolving to each bucket, instead of a row per URL.",
+					},
+					&cli.BoolFlag{
+						Name:  "only-takeover",
+						Usage: "Display and store only URLs with buckets vulnerable to takeover.",
+					},
+					&cli.BoolFlag{
+						Name:  "show-failures",
+						Usage: "Display URLs that couldn't be processed in the table, with the reason why.",
+					},
 					&cli.StringFlag{
 						Name:    "output",
 						Usage:   "Path where resultant buckets only are stored, seperated by newline.",
 						Aliases: []string{"o"},
 					},
+					&cli.StringFlag{
+						Name:  "csv",
+						Usage: "Path where all processed URLs and their results are stored as CSV.",
+					},
+					&cli.StringFlag{
+						Name:  "metrics-file",
+						Usage: "Path where Prometheus metrics for the URLs resolved are stored, ie. for the node_exporter textfile collector.",
+					},
+					&cli.StringFlag{
+						Name:  "webhook",
+						Usage: "URL a JSON summary of the URLs resolved is posted to when done, ie. a Slack incoming webhook.",
+					},
+					&cli.StringSliceFlag{
+						Name:  "regions",
+						Usage: "Comma-separated regions to probe for buckets in, instead of discovering each bucket's region.",
+					},
+					&cli.StringFlag{
+						Name:    "profile",
+						Usage:   "IAM profile used when checking if buckets exist, ie. for buckets in your own account that aren't public.",
+						Aliases: []string{"i"},
+					},
+					&cli.BoolFlag{
+						Name:  "claim",
+						Usage: "Create unclaimed buckets vulnerable to takeover with --profile to demonstrate it (WARNING: creates real buckets, only for authorized testing). Requires --allow-destructive.",
+					},
+					&cli.BoolFlag{
+						Name:  "allow-destructive",
+						Usage: "Confirms actions that create or modify real resources, ie. --claim.",
+					},
+					&cli.BoolFlag{
+						Name:  "stream",
+						Usage: "Write each result as a line of JSON as soon as it's resolved, instead of a table.",
+					},
+					&cli.StringFlag{
+						Name:  "stream-file",
+						Usage: "Path to write streamed results to instead of stdout.",
+					},
+					&cli.IntFlag{
+						Name:    "concurrency",
+						Usage:   "Number of URLs to resolve at the same time.",
+						Value:   1,
+						Aliases: []string{"c"},
+					},
+					&cli.DurationFlag{
+						Name:    "timeout",
+						Usage:   "Maximum time to wait on a URL to respond.",
+						Value:   slamdunk.DefaultTimeout,
+						Aliases: []string{"t"},
+					},
+					&cli.StringFlag{
+						Name:  "dns",
+						Usage: "Address of a DNS server used for CNAME lookups instead of the system resolver, ie. 8.8.8.8.",
+					},
+					&cli.DurationFlag{
+						Name:  "dns-timeout",
+						Usage: "Maximum time to wait on a single DNS lookup, or 0 for no limit.",
+						Value: 2 * time.Second,
+					},
+					&cli.BoolFlag{
+						Name:  "no-progress",
+						Usage: "Don't display a progress counter on stderr while running.",
+					},
 				},
 				Action: func(c *cli.Context) error {
-					if !c.Bool("verbose") {
-						log.SetOutput(ioutil.Discard)
+					if err := ConfigureLogging(c); err != nil {
+						return err
 					}
-					log.Printf("Starting slamdunk.")
+					slamdunk.Log.Debugf("Starting slamdunk.")
 
 					urls := c.StringSlice("url")
 					file := c.String("file")
@@ -209,6 +867,15 @@ func main() {
 						return errors.New("Must specify both or either `--url` or `--file`.")
 					}
 
+					// claiming creates real buckets, so it must be explicitly confirmed and done as a known principal
+					claim := c.Bool("claim")
+					if claim && !c.Bool("allow-destructive") {
+						return errors.New("Cannot use `--claim` without `--allow-destructive`.")
+					}
+					if claim && c.String("profile") == "" {
+						return errors.New("Cannot use `--claim` without `--profile`, as buckets are created in that account.")
+					}
+
 					// if file specified, append to URLs
 					if file != "" {
 						vals, err := ReadLines(file)
@@ -217,43 +884,243 @@ func main() {
 						}
 						urls = append(urls, *vals...)
 					}
-					log.Printf("Number of URLs parsed for processing: %d\n", len(urls))
+					urls = NormalizeUrls(urls)
+					slamdunk.Log.Debugf("Number of URLs parsed for processing: %d\n", len(urls))
 
 					outputPath := c.String("output")
+					csvPath := c.String("csv")
 
 					// stores contents for making an ASCII table
-					header := []string{"URL", "Bucket Name", "Region", "Vulnerable to Takeover?"}
+					header := []string{"URL", "Bucket Name", "Region", "Provider", "Vulnerable to Takeover?", "Claimable?"}
 
 					// actual object that interfaces with resolving
-					resolver := slamdunk.NewResolver()
-
-					// handle keyboard interrupts to output table with content so far
-					log.Println("Installing signal handler to handle interrupts")
-					channel := make(chan os.Signal)
-					signal.Notify(channel, os.Interrupt, syscall.SIGTERM)
-					go func() {
-						<-channel
-						log.Println("Ctrl+C pressed, interrupting execution...")
-						PrintTable(header, resolver.Table())
-						if err := resolver.OutputStats(outputPath); err != nil {
-							log.Fatal(err)
-						}
-						os.Exit(0)
-					}()
+					opts := []slamdunk.ResolverOption{
+						slamdunk.WithTimeout(c.Duration("timeout")),
+						slamdunk.WithConcurrency(c.Int("concurrency")),
+						slamdunk.WithDNSTimeout(c.Duration("dns-timeout")),
+					}
+					if server := c.String("dns"); server != "" {
+						opts = append(opts, slamdunk.WithDNSResolver(slamdunk.NewDNSResolver(server)))
+					}
+					resolver := slamdunk.NewResolver(opts...)
+					resolver.Regions = SplitCommas(c.StringSlice("regions"))
+					resolver.OnlyTakeover = c.Bool("only-takeover")
+					resolver.Dedupe = c.Bool("dedupe")
+					resolver.ShowFailures = c.Bool("show-failures")
+					if resolver.ShowFailures {
+						header = append(header, "Reason")
+					}
+					profile := c.String("profile")
+					if profile != "" || c.String("credentials-file") != "" || c.String("config-file") != "" {
+						slamdunk.Log.Debug("Using IAM profile", profile)
+						resolver.Config = &slamdunk.SessionConfig{
+							Profile:         profile,
+							CredentialsFile: c.String("credentials-file"),
+							ConfigFile:      c.String("config-file"),
+						}
+					}
+
+					// if streaming, write each result as NDJSON as it comes in
+					stream := c.Bool("stream") || c.String("stream-file") != ""
+					if stream {
+						out := os.Stdout
+						if streamPath := c.String("stream-file"); streamPath != "" {
+							file, err := os.Create(streamPath)
+							if err != nil {
+								return err
+							}
+							defer file.Close()
+							out = file
+						}
+						encoder := json.NewEncoder(out)
+						resolver.OnResolve = func(status slamdunk.ResolverStatus) {
+							if err := encoder.Encode(status); err != nil {
+								slamdunk.Log.Error(err)
+							}
+						}
+					}
+
+					// count each URL once it's done, even if it didn't store a status
+					progress := NewProgress("Resolved", "URLs", len(urls), c.Bool("no-progress") || Logging(c))
+					resolver.OnProgress = progress.Incr
+
+					// display results, unless they were already streamed
+					finish := func() error {
+						progress.Done()
+						if stream {
+							if outputPath != "" {
+								if err := resolver.OutputBuckets(outputPath); err != nil {
+									return err
+								}
+							}
+						} else {
+							PrintTable(header, resolver.Table())
+							if err := resolver.OutputStats(os.Stdout, outputPath); err != nil {
+								return err
+							}
+						}
+						if metricsPath := c.String("metrics-file"); metricsPath != "" {
+							if err := resolver.OutputMetrics(metricsPath); err != nil {
+								return err
+							}
+						}
+						if webhook := c.String("webhook"); webhook != "" {
+							if err := slamdunk.Notify(webhook, resolver.Notification()); err != nil {
+								color.Yellow("WARNING: couldn't notify webhook: %s", err)
+							}
+						}
+						if csvPath != "" {
+							return resolver.OutputCSV(csvPath)
+						}
+						return nil
+					}
+
+					// handle keyboard interrupts by waiting on URLs in flight, and outputting content so far
+					ctx, cancel := interruptContext()
+					defer cancel()
 
 					// resolve each and parse output for display
-					for _, url := range urls {
-						log.Printf("Attempting to resolve %s...\n", url)
-						err := resolver.Resolve(url)
+					resolver.ResolveAllContext(ctx, urls, resolver.Concurrency)
+					if err := finish(); err != nil {
+						return err
+					}
+
+					// demonstrate takeovers by creating the buckets, unless interrupted
+					if claim && ctx.Err() == nil {
+						claimable := resolver.Claimable()
+						if len(claimable) != 0 {
+							color.Red("WARNING: creating %d buckets in the account for profile %s to demonstrate takeover.", len(claimable), c.String("profile"))
+						}
+						for _, status := range claimable {
+							if err := slamdunk.ClaimBucket(resolver.Config, status.Bucket, status.Region); err != nil {
+								slamdunk.Log.Error(err)
+								continue
+							}
+							color.Green("Claimed %s in %s, taking over %s", status.Bucket, status.Region, status.Url)
+						}
+					}
+					if c.Bool("fail-on-takeover") && resolver.TakeoverPossible != 0 {
+						return cli.Exit(fmt.Sprintf("Found %d buckets vulnerable to takeover.", resolver.TakeoverPossible), ExitTakeover)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "enumerate",
+				Usage: "Given keyword(s), ie. a company name, generate candidate bucket names and check which ones exist",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:    "keyword",
+						Usage:   "Keyword to generate candidate bucket names from. Can be invoked multiple times.",
+						Aliases: []string{"k"},
+					},
+					&cli.StringSliceFlag{
+						Name:    "affix",
+						Usage:   "Word to prepend and append to keywords, replacing the default list. Can be invoked multiple times.",
+						Aliases: []string{"a"},
+					},
+					&cli.StringFlag{
+						Name:    "file",
+						Usage:   "File with multiple affixes to use, replacing the default list.",
+						Aliases: []string{"f"},
+					},
+					&cli.IntFlag{
+						Name:    "concurrency",
+						Usage:   "Number of candidates to check at the same time.",
+						Value:   10,
+						Aliases: []string{"c"},
+					},
+					&cli.BoolFlag{
+						Name:  "dns-prefilter",
+						Usage: "Skip candidates whose names don't resolve in DNS before calling S3.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if err := ConfigureLogging(c); err != nil {
+						return err
+					}
+					slamdunk.Log.Debugf("Starting slamdunk.")
+
+					keywords := c.StringSlice("keyword")
+					if len(keywords) == 0 {
+						return errors.New("Must specify at least one `--keyword`.")
+					}
+
+					// use the default affixes unless some were given
+					affixes := c.StringSlice("affix")
+					if file := c.String("file"); file != "" {
+						vals, err := ReadLines(file)
 						if err != nil {
-							log.Println(err)
-							continue
+							return err
+						}
+						affixes = append(affixes, *vals...)
+					}
+					if len(affixes) == 0 {
+						affixes = slamdunk.DefaultAffixes
+					}
+
+					candidates := []string{}
+					for _, keyword := range keywords {
+						candidates = append(candidates, slamdunk.GenerateCandidates(keyword, affixes)...)
+					}
+					candidates = NormalizeBuckets(candidates)
+					if len(candidates) == 0 {
+						return errors.New("No valid bucket names could be generated from the keywords given.")
+					}
+					slamdunk.Log.Debugf("Generated %d candidate buckets to check\n", len(candidates))
+
+					// checking DNS is much cheaper than S3, so drop clearly dead names first
+					checked := candidates
+					if c.Bool("dns-prefilter") {
+						checked = slamdunk.PrefilterDNS(candidates, c.Int("concurrency"))
+						slamdunk.Log.Debugf("%d candidates left after DNS pre-filter\n", len(checked))
+					}
+
+					table := [][]string{}
+					for _, candidate := range slamdunk.CheckCandidates(checked, c.Int("concurrency")) {
+						if candidate.Exists {
+							table = append(table, []string{candidate.Name, candidate.Region})
 						}
 					}
-					PrintTable(header, resolver.Table())
-					if err := resolver.OutputStats(outputPath); err != nil {
+
+					fmt.Printf("Found %d existing buckets out of %d candidates:\n\n", len(table), len(candidates))
+					PrintTable([]string{"Bucket Name", "Region"}, table)
+					return nil
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "Given two state files saved with audit --resume, report buckets and permissions that changed between the audits",
+				ArgsUsage: "OLD NEW",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "If set, prints the changes as JSON.",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 2 {
+						return errors.New("Must specify an older and a newer state file to compare.")
+					}
+					previous, err := slamdunk.LoadAudit(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					current, err := slamdunk.LoadAudit(c.Args().Get(1))
+					if err != nil {
 						return err
 					}
+
+					diff := slamdunk.DiffAudits(previous, current)
+					if c.Bool("json") {
+						data, err := json.MarshalIndent(diff, "", "  ")
+						if err != nil {
+							return err
+						}
+						fmt.Println(string(data))
+						return nil
+					}
+					diff.Write(color.Output)
 					return nil
 				},
 			},
@@ -266,25 +1133,37 @@ func main() {
 						Usage:   "If set, prints information only about specific action in playbook.",
 						Aliases: []string{"a"},
 					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "If set, prints actions as JSON, including whether they read or write.",
+					},
 				},
 				Action: func(c *cli.Context) error {
 					playbook := slamdunk.NewPlayBook()
 
-					// stores contents for making an ASCII table
-					table := [][]string{}
-
 					// search for action if specified
 					actionName := c.String("action")
 					if actionName != "" {
-						if action, ok := playbook[actionName]; ok {
-							table = append(table, action.TableEntry(actionName))
-						} else {
+						action, ok := playbook[actionName]
+						if !ok {
 							return errors.New("Cannot find specified action in playbook.")
 						}
-					} else {
-						for name, action := range playbook {
-							table = append(table, action.TableEntry(name))
+						playbook = slamdunk.PlayBook{actionName: action}
+					}
+
+					if c.Bool("json") {
+						data, err := json.MarshalIndent(playbook.Info(), "", "  ")
+						if err != nil {
+							return err
 						}
+						fmt.Println(string(data))
+						return nil
+					}
+
+					// stores contents for making an ASCII table
+					table := [][]string{}
+					for name, action := range playbook {
+						table = append(table, action.TableEntry(name))
 					}
 
 					header := []string{"Action", "Description", "Equivalent Command"}
@@ -298,5 +1177,6 @@ func main() {
 	err := app.Run(os.Args)
 	if err != nil {
 		fmt.Println("ERROR:", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,128 @@
+package slamdunk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/fatih/color"
+)
+
+// Permissions that changed for a bucket present in both audits
+type BucketDiff struct {
+	Bucket string `json:"bucket"`
+
+	// actions allowed now that weren't before
+	Granted []string `json:"granted,omitempty"`
+
+	// actions allowed before that aren't anymore
+	Revoked []string `json:"revoked,omitempty"`
+}
+
+// What changed between two audits of the same buckets, ie. from scheduled runs.
+type AuditDiff struct {
+	// buckets only in the newer audit
+	Added []string `json:"added"`
+
+	// buckets only in the older audit
+	Removed []string `json:"removed"`
+
+	// buckets in both audits whose permissions changed
+	Changed []BucketDiff `json:"changed"`
+}
+
+// Read the results of an audit from a state file written by `SaveState`.
+func LoadAudit(path string) (Audit, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state auditorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state.Results, nil
+}
+
+// Compare an older audit against a newer one, finding buckets that appeared or disappeared, and permissions
+// that were granted or revoked for buckets in both. Everything is sorted so diffs are stable between runs.
+func DiffAudits(previous Audit, current Audit) AuditDiff {
+	diff := AuditDiff{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []BucketDiff{},
+	}
+
+	for bucket := range previous {
+		if _, ok := current[bucket]; !ok {
+			diff.Removed = append(diff.Removed, bucket)
+		}
+	}
+	for bucket, actions := range current {
+		before, ok := previous[bucket]
+		if !ok {
+			diff.Added = append(diff.Added, bucket)
+			continue
+		}
+
+		changed := BucketDiff{Bucket: bucket}
+		for perm, allowed := range actions {
+			if allowed && !before[perm] {
+				changed.Granted = append(changed.Granted, perm)
+			}
+		}
+		for perm, allowed := range before {
+			if allowed && !actions[perm] {
+				changed.Revoked = append(changed.Revoked, perm)
+			}
+		}
+		if len(changed.Granted) != 0 || len(changed.Revoked) != 0 {
+			sort.Strings(changed.Granted)
+			sort.Strings(changed.Revoked)
+			diff.Changed = append(diff.Changed, changed)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Bucket < diff.Changed[j].Bucket
+	})
+	return diff
+}
+
+// Checks if nothing changed between the audits.
+func (d AuditDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Write the changes between audits, highlighting newly granted permissions since they widen access.
+func (d AuditDiff) Write(w io.Writer) {
+	if d.Empty() {
+		fmt.Fprintf(w, "No changes between audits.\n")
+		return
+	}
+
+	name := color.New(color.Bold)
+	highlight := color.New(color.Bold, color.FgRed)
+	for _, bucket := range d.Added {
+		name.Fprintf(w, "+ %s\n", bucket)
+	}
+	for _, bucket := range d.Removed {
+		name.Fprintf(w, "- %s\n", bucket)
+	}
+	for _, changed := range d.Changed {
+		name.Fprintln(w, "* ", changed.Bucket)
+		if len(changed.Granted) != 0 {
+			highlight.Fprintf(w, "\tGRANTED: ")
+			fmt.Fprintf(w, "%v\n", changed.Granted)
+		}
+		if len(changed.Revoked) != 0 {
+			name.Fprintf(w, "\tREVOKED: ")
+			fmt.Fprintf(w, "%v\n", changed.Revoked)
+		}
+	}
+}
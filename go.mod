@@ -15,4 +15,6 @@ require (
 	github.com/stretchr/testify v1.5.1 // indirect
 	github.com/urfave/cli/v2 v2.3.0 // indirect
 	golang.org/x/sys v0.0.0-20210426230700-d19ff857e887 // indirect
+	golang.org/x/time v0.3.0
+	gopkg.in/yaml.v2 v2.4.0
 )
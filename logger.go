@@ -0,0 +1,100 @@
+package slamdunk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severity of a log message, where a logger only writes messages at or above its level
+type LogLevel int
+
+const (
+	LevelError LogLevel = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+var levelNames = map[LogLevel]string{
+	LevelError: "error",
+	LevelWarn:  "warn",
+	LevelInfo:  "info",
+	LevelDebug: "debug",
+}
+
+// Parse a level by name, one of error, warn, info or debug.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LevelError, fmt.Errorf("Unsupported log level %s, must be one of error, warn, info or debug.", name)
+}
+
+// Small leveled logger that writes either plain lines like the standard logger, or JSON lines for
+// pipelines that ingest structured logs.
+type Logger struct {
+	out   io.Writer
+	level LogLevel
+	json  bool
+	mu    sync.Mutex
+}
+
+// Logger used across the package, which by default writes everything to stderr.
+var Log = NewLogger(os.Stderr, LevelDebug, false)
+
+// Create a new logger writing messages at or above a level to an output.
+func NewLogger(out io.Writer, level LogLevel, json bool) *Logger {
+	return &Logger{
+		out:   out,
+		level: level,
+		json:  json,
+	}
+}
+
+// Serialized form of a single message when logging as JSON
+type logEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+}
+
+func (l *Logger) write(level LogLevel, msg string) {
+	if level > l.level {
+		return
+	}
+	msg = strings.TrimSuffix(msg, "\n")
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		data, err := json.Marshal(logEntry{
+			Time:    now.Format(time.RFC3339),
+			Level:   levelNames[level],
+			Message: msg,
+		})
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(l.out, string(data))
+	} else {
+		fmt.Fprintf(l.out, "%s %s %s\n", now.Format("2006/01/02 15:04:05"), strings.ToUpper(levelNames[level]), msg)
+	}
+}
+
+func (l *Logger) Debug(v ...interface{}) { l.write(LevelDebug, fmt.Sprintln(v...)) }
+func (l *Logger) Info(v ...interface{})  { l.write(LevelInfo, fmt.Sprintln(v...)) }
+func (l *Logger) Warn(v ...interface{})  { l.write(LevelWarn, fmt.Sprintln(v...)) }
+func (l *Logger) Error(v ...interface{}) { l.write(LevelError, fmt.Sprintln(v...)) }
+
+func (l *Logger) Debugf(format string, v ...interface{}) { l.write(LevelDebug, fmt.Sprintf(format, v...)) }
+func (l *Logger) Infof(format string, v ...interface{})  { l.write(LevelInfo, fmt.Sprintf(format, v...)) }
+func (l *Logger) Warnf(format string, v ...interface{})  { l.write(LevelWarn, fmt.Sprintf(format, v...)) }
+func (l *Logger) Errorf(format string, v ...interface{}) { l.write(LevelError, fmt.Sprintf(format, v...)) }
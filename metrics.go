@@ -0,0 +1,114 @@
+package slamdunk
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Single metric in the Prometheus text exposition format, optionally with labels per sample
+type metric struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+type metricSample struct {
+	labels string
+	value  int
+}
+
+// Helper that creates a metric with a single unlabeled sample.
+func gauge(name string, help string, value int) metric {
+	return metric{
+		name:    name,
+		help:    help,
+		samples: []metricSample{{value: value}},
+	}
+}
+
+// Serialize metrics into the Prometheus text format, as read by the node_exporter textfile collector.
+func formatMetrics(metrics []metric) []byte {
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", m.name)
+		for _, sample := range m.samples {
+			if sample.labels != "" {
+				fmt.Fprintf(&buf, "%s{%s} %d\n", m.name, sample.labels, sample.value)
+			} else {
+				fmt.Fprintf(&buf, "%s %d\n", m.name, sample.value)
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// Generate metrics for the findings of an audit, including how many buckets allow each action.
+func (a *Auditor) Metrics() []byte {
+	findings := a.Findings()
+	audit := a.Snapshot()
+
+	failed := 0
+	for bucket, details := range a.SnapshotDetails() {
+		if _, ok := audit[bucket]; !ok && details.Status != StatusSkipped {
+			failed += 1
+		}
+	}
+
+	tally := map[string]int{}
+	for _, action := range audit {
+		for perm, result := range action {
+			if result {
+				tally[perm] += 1
+			}
+		}
+	}
+	perms := []string{}
+	for perm := range tally {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+
+	allowed := metric{
+		name: "slamdunk_action_allowed",
+		help: "Number of buckets allowing each action.",
+	}
+	for _, perm := range perms {
+		allowed.samples = append(allowed.samples, metricSample{
+			labels: fmt.Sprintf("action=%q", perm),
+			value:  tally[perm],
+		})
+	}
+
+	return formatMetrics([]metric{
+		gauge("slamdunk_buckets_audited", "Number of buckets audited.", len(audit)),
+		gauge("slamdunk_buckets_failed", "Number of buckets that couldn't be audited.", failed),
+		gauge("slamdunk_read_findings", "Number of buckets allowing reads.", findings.Readable),
+		gauge("slamdunk_write_findings", "Number of buckets allowing writes.", findings.Writable),
+		gauge("slamdunk_public_findings", "Number of buckets that are public.", findings.Public),
+		gauge("slamdunk_locked_buckets", "Number of buckets allowing no actions.", findings.Locked),
+		gauge("slamdunk_logging_disabled_findings", "Number of buckets with server access logging disabled.", findings.LoggingDisabled),
+		allowed,
+	})
+}
+
+// Write the metrics for an audit to a filepath, ie. in a node_exporter textfile collector directory.
+func (a *Auditor) OutputMetrics(path string) error {
+	return writeFileAtomic(path, a.Metrics())
+}
+
+// Generate metrics for the URLs resolved, and how many can be taken over.
+func (r *Resolver) Metrics() []byte {
+	return formatMetrics([]metric{
+		gauge("slamdunk_urls_processed", "Number of URLs successfully processed.", r.UrlsProcessed),
+		gauge("slamdunk_urls_failed", "Number of URLs that failed to process.", r.UrlsFailed),
+		gauge("slamdunk_endpoints", "Number of S3 endpoints identified.", r.Endpoints),
+		gauge("slamdunk_takeovers", "Number of endpoints vulnerable to takeover.", r.TakeoverPossible),
+	})
+}
+
+// Write the metrics for resolved URLs to a filepath, ie. in a node_exporter textfile collector directory.
+func (r *Resolver) OutputMetrics(path string) error {
+	return writeFileAtomic(path, r.Metrics())
+}
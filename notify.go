@@ -0,0 +1,114 @@
+package slamdunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// How long to wait on a webhook to accept a notification
+const NotifyTimeout = 10 * time.Second
+
+// Summary of a completed scan posted to a webhook. The `text` field is what Slack incoming webhooks display,
+// while other consumers can use the counts and buckets directly.
+type Notification struct {
+	// one line summary of the findings
+	Text string `json:"text"`
+
+	// command that ran the scan, ie. `audit` or `resolve`
+	Command string `json:"command"`
+
+	// finding counts, keyed by what was counted
+	Counts map[string]int `json:"counts"`
+
+	// buckets allowing writes, and buckets that are public, if auditing
+	Writable []string `json:"writable,omitempty"`
+	Public   []string `json:"public,omitempty"`
+
+	// URLs pointing at buckets that can be taken over, if resolving
+	Takeovers []string `json:"takeovers,omitempty"`
+}
+
+// Summarize an audit to notify a webhook with.
+func (a *Auditor) Notification() Notification {
+	findings := a.Findings()
+	audit, details := a.Snapshot(), a.SnapshotDetails()
+	writable := []string{}
+	public := []string{}
+	for bucket, action := range audit {
+		for perm, result := range action {
+			if result && a.isWrite(perm) {
+				writable = append(writable, bucket)
+				break
+			}
+		}
+		if detail, ok := details[bucket]; ok {
+			if (detail.Public != nil && *detail.Public) || len(detail.PublicGrants) != 0 {
+				public = append(public, bucket)
+			}
+		}
+	}
+	sort.Strings(writable)
+	sort.Strings(public)
+
+	return Notification{
+		Text: fmt.Sprintf("slamdunk audited %d buckets: %d readable, %d writable, %d public.",
+			len(audit), findings.Readable, findings.Writable, findings.Public),
+		Command: "audit",
+		Counts: map[string]int{
+			"audited":  len(audit),
+			"readable": findings.Readable,
+			"writable": findings.Writable,
+			"public":   findings.Public,
+			"locked":   findings.Locked,
+		},
+		Writable: writable,
+		Public:   public,
+	}
+}
+
+// Summarize the URLs resolved to notify a webhook with.
+func (r *Resolver) Notification() Notification {
+	summary := r.Summary()
+	takeovers := []string{}
+	for _, status := range r.Snapshot() {
+		if status.Takeover {
+			takeovers = append(takeovers, status.Url)
+		}
+	}
+	sort.Strings(takeovers)
+
+	return Notification{
+		Text: fmt.Sprintf("slamdunk resolved %d URLs: %d S3 endpoints, %d takeovers possible.",
+			summary.Processed, summary.Endpoints, summary.Takeovers),
+		Command: "resolve",
+		Counts: map[string]int{
+			"processed": summary.Processed,
+			"failed":    summary.Failed,
+			"endpoints": summary.Endpoints,
+			"buckets":   summary.UniqueBucketNames,
+			"takeovers": summary.Takeovers,
+		},
+		Takeovers: takeovers,
+	}
+}
+
+// Post a notification as JSON to a webhook, ie. a Slack incoming webhook, through the proxy if one is set.
+func Notify(url string, notification Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	resp, err := NewHTTPClient(NotifyTimeout).Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook responded with status %d.", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package slamdunk
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Common words prepended or appended to a keyword when generating candidate bucket names
+var DefaultAffixes = []string{
+	"assets", "backup", "backups", "cdn", "data", "dev", "development", "files", "images", "logs",
+	"media", "private", "prod", "production", "public", "s3", "stage", "staging", "static", "test",
+	"uploads", "web", "www",
+}
+
+// Separators that are valid in bucket names and commonly used between words
+var separators = []string{"", "-", "."}
+
+// Result of checking if a candidate bucket name exists.
+type Candidate struct {
+	Name   string `json:"name"`
+	Exists bool   `json:"exists"`
+	Region string `json:"region"`
+}
+
+// Generate candidate bucket names from a keyword, ie. a company name, by joining it with each affix
+// as both a prefix and suffix. The keyword itself is the first candidate, and names that break the S3 naming
+// rules are left out.
+func GenerateCandidates(base string, affixes []string) []string {
+	base = strings.ToLower(strings.TrimSpace(base))
+	if base == "" {
+		return []string{}
+	}
+
+	seen := map[string]bool{}
+	candidates := []string{}
+	add := func(name string) {
+		if !seen[name] && IsValidBucketName(name) {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+
+	add(base)
+	for _, affix := range affixes {
+		affix = strings.ToLower(strings.TrimSpace(affix))
+		if affix == "" {
+			continue
+		}
+		for _, sep := range separators {
+			add(base + sep + affix)
+			add(affix + sep + base)
+		}
+	}
+	return candidates
+}
+
+// Drop candidates whose names don't resolve in DNS with the given number of workers, as a fast pre-filter
+// before checking them against S3. Order is kept for the names remaining.
+func PrefilterDNS(names []string, concurrency int) []string {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	alive := make([]bool, len(names))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				alive[idx] = BucketExistsDNS(names[idx])
+			}
+		}()
+	}
+	for idx := range names {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+
+	filtered := []string{}
+	for idx, name := range names {
+		if alive[idx] {
+			filtered = append(filtered, name)
+		} else {
+			Log.Debugf("Skipping %s, doesn't resolve in DNS\n", name)
+		}
+	}
+	return filtered
+}
+
+// Check if each candidate bucket exists with the given number of workers, returning results in the
+// same order as the candidates.
+func CheckCandidates(names []string, concurrency int) []Candidate {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]Candidate, len(names))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				name := names[idx]
+				Log.Debugf("Checking if %s exists...\n", name)
+				exists, region, err := CheckBucketExists(context.Background(), nil, name, NoRegion)
+				if err != nil {
+					Log.Debug(err)
+				}
+				results[idx] = Candidate{
+					Name:   name,
+					Exists: exists,
+					Region: region,
+				}
+			}
+		}()
+	}
+	for idx := range names {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+	return results
+}
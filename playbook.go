@@ -1,25 +1,62 @@
 package slamdunk
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"gopkg.in/yaml.v2"
 )
 
 const (
-	TempObject = "temp"
+	// prefix of keys used by write actions, so any object left behind is clearly from slamdunk
+	TempObject = "slamdunk-probe"
+
+	// how long to keep trying to restore something a destructive action removed, independent of the action's
+	// own timeout, which may already be used up
+	RestoreTimeout = 30 * time.Second
 )
 
+// Generate a random key for a write action to use, so concurrent checks never collide with each other
+// or with real objects.
+func ProbeKey() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%s-%d", TempObject, time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%s-%s", TempObject, hex.EncodeToString(buf))
+}
+
 // Encapsulates all of the actions we can execute against a target bucket.
 type PlayBook map[string]Action
 
+// Kind of access an action tests for
+type ActionCategory string
+
+const (
+	// only reads from a bucket
+	CategoryRead ActionCategory = "read"
+
+	// modifies a bucket, but in a way that avoids actually changing it
+	CategoryWrite ActionCategory = "write"
+
+	// modifies a bucket and can't avoid actually changing it
+	CategoryDestructive ActionCategory = "destructive"
+)
+
 // Implementation of a specific heuristic we want to check for against a target.
 type Action struct {
 	// High-level description of what permission is tested
@@ -28,25 +65,319 @@ type Action struct {
 	// equivalent aws CLI command
 	Cmd string
 
-	// function called to consume AWS session and wrapped input for testing
-	Callback func(s3.S3, string) bool
+	// function called to consume AWS session and wrapped input for testing, bounded by the context
+	Callback func(aws.Context, s3.S3, *Target) bool
+
+	// set if the action can't avoid actually modifying the bucket when allowed, so it only runs when
+	// explicitly enabled on top of write actions
+	Destructive bool
+
+	// kind of access tested, inferred from the action's name if not set, ie. for custom actions
+	Category ActionCategory
+}
+
+// Get the kind of access an action tests for, inferring it from its name if not set explicitly. An action
+// flagged as destructive is always classified as such, even if its category says otherwise, so it can never
+// slip past the gate for destructive actions.
+func (a *Action) Classify(name string) ActionCategory {
+	if a.Destructive {
+		return CategoryDestructive
+	}
+	if a.Category != "" {
+		return a.Category
+	}
+	if isWriteName(name) {
+		return CategoryWrite
+	}
+	return CategoryRead
+}
+
+// Machine-readable description of an action in the playbook
+type ActionInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Command     string         `json:"command"`
+	Category    ActionCategory `json:"category"`
+	Destructive bool           `json:"destructive"`
+}
+
+// Describe an action for serializing, ie. for other tools to validate action names against.
+func (a *Action) Info(name string) ActionInfo {
+	category := a.Classify(name)
+	return ActionInfo{
+		Name:        name,
+		Description: a.Description,
+		Command:     "aws s3api " + a.Cmd,
+		Category:    category,
+		Destructive: category == CategoryDestructive,
+	}
+}
+
+// Find the name of the action in the playbook closest to a misspelled one, ie. `ListObject` to `ListObjects`,
+// or an empty string if none is close enough to be a likely typo.
+func (p PlayBook) Closest(name string) string {
+	best := ""
+	bestDistance := len(name)/3 + 2
+	for candidate := range p {
+		distance := levenshtein(strings.ToLower(name), strings.ToLower(candidate))
+		if distance < bestDistance || (distance == bestDistance && best != "" && candidate < best) {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// Helper that computes the edit distance between two strings.
+func levenshtein(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
+
+// Describe every action in the playbook, sorted by name.
+func (p PlayBook) Info() []ActionInfo {
+	names := []string{}
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	infos := []ActionInfo{}
+	for _, name := range names {
+		action := p[name]
+		infos = append(infos, action.Info(name))
+	}
+	return infos
+}
+
+// Describes the bucket, and optionally an object within it, that an action is tested against.
+type Target struct {
+	// name of the bucket
+	Bucket string
+
+	// key of an object used by object-level actions. If empty, one is listed from the bucket when needed.
+	Key string
+
+	// if set, listing and object-level actions are scoped to keys under this prefix
+	Prefix string
+
+	// where metadata discovered by actions about the bucket is recorded, if set
+	Details *BucketDetails
+
+	// guards listing a key, as actions may run concurrently
+	mu sync.Mutex
+
+	// guards recording details, separately so listing a key doesn't hold up other actions
+	detailsMu sync.Mutex
+}
+
+// Get the key of an object to test object-level actions against, listing the first object in the bucket
+// if none was specified, so a listing chains into object-level checks in the same audit. Falls back on
+// `ListObjectsV2` if the V1 listing is denied. Returns false if no key could be found.
+func (t *Target) ObjectKey(ctx aws.Context, svc s3.S3) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.Key != "" {
+		return t.Key, true
+	}
+
+	input := &s3.ListObjectsInput{
+		Bucket:  aws.String(t.Bucket),
+		MaxKeys: aws.Int64(1),
+	}
+	if t.Prefix != "" {
+		input.Prefix = aws.String(t.Prefix)
+	}
+	if output, err := svc.ListObjectsWithContext(ctx, input); err == nil && len(output.Contents) != 0 {
+		t.Key = aws.StringValue(output.Contents[0].Key)
+	} else if keys := SampleObjects(ctx, svc, t.Bucket, t.Prefix, 1); len(keys) != 0 {
+		t.Key = keys[0]
+	} else {
+		return "", false
+	}
+
+	Log.Debugf("Listed %s from %s for object-level actions\n", t.Key, t.Bucket)
+	key := t.Key
+	t.Record(func(details *BucketDetails) {
+		details.ListedKey = key
+	})
+	return t.Key, true
+}
+
+// Safely record metadata discovered by an action, as actions may run concurrently. Does nothing if the
+// target has no details to record into.
+func (t *Target) Record(update func(details *BucketDetails)) {
+	if t.Details == nil {
+		return
+	}
+	t.detailsMu.Lock()
+	defer t.detailsMu.Unlock()
+	update(t.Details)
+}
+
+// Record an error that stopped an action from running, so it shows up as errored rather than denied.
+func (t *Target) Error(action string, err error) {
+	t.Record(func(details *BucketDetails) {
+		if details.Errors == nil {
+			details.Errors = map[string]string{}
+		}
+		details.Errors[action] = err.Error()
+	})
+}
+
+// Checks if an action can modify a bucket or its contents, and thus should only run when writes are enabled.
+// Uses the category of registered actions, only falling back on the name for unknown ones.
+func IsWriteAction(name string) bool {
+	registryMu.Lock()
+	action, ok := registry[name]
+	registryMu.Unlock()
+	if ok {
+		return action.Classify(name) != CategoryRead
+	}
+	return isWriteName(name)
+}
+
+// Helper that guesses if an action writes from its name, for actions without a category.
+func isWriteName(name string) bool {
+	return strings.HasPrefix(name, "Put") || strings.HasPrefix(name, "Delete")
 }
 
 func (a *Action) TableEntry(name string) []string {
 	return []string{name, a.Description, "aws s3api " + a.Cmd}
 }
 
+var (
+	// every action available to playbooks, including custom ones added with `RegisterAction`
+	registry   = builtinActions()
+	registryMu sync.Mutex
+)
+
+// Register a custom action, or replace a built-in one of the same name, so that it's included in every
+// playbook created afterwards. Registration should happen before calling `NewAuditor`, as an auditor's
+// playbook is built when it's created.
+func RegisterAction(name string, action Action) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = action
+}
+
+// Create a new playbook with every registered action.
 func NewPlayBook() PlayBook {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	playbook := PlayBook{}
+	for name, action := range registry {
+		playbook[name] = action
+	}
+	return playbook
+}
+
+// Run a single registered action by name against a bucket, without needing an auditor. Errors if no action
+// is registered with the name.
+func RunAction(svc s3.S3, name string, bucket string) (bool, error) {
+	action, ok := NewPlayBook()[name]
+	if !ok {
+		return false, fmt.Errorf("Cannot find action %s in playbook.", name)
+	}
+	target := &Target{
+		Bucket: bucket,
+	}
+	return action.Callback(aws.BackgroundContext(), svc, target), nil
+}
+
+// Actions supported out of the box.
+func builtinActions() PlayBook {
 	return map[string]Action{
 		"ListObjects": Action{
 			Description: "Read and enumerate over objects in bucket.",
 			Cmd:         "list-objects --bucket <NAME>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				input := &s3.ListObjectsInput{
-					Bucket:  aws.String(name),
+					Bucket:  aws.String(target.Bucket),
 					MaxKeys: aws.Int64(2),
 				}
-				if _, err := svc.ListObjects(input); err != nil {
+				if target.Prefix != "" {
+					input.Prefix = aws.String(target.Prefix)
+				}
+				if _, err := svc.ListObjectsWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		// S3 recommends V2 for listing, and a policy or proxy may treat it differently than V1, so both are tested
+		"ListObjectsV2": Action{
+			Description: "Read and enumerate over objects with the V2 listing API.",
+			Cmd:         "list-objects-v2 --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.ListObjectsV2Input{
+					Bucket:  aws.String(target.Bucket),
+					MaxKeys: aws.Int64(2),
+				}
+				if target.Prefix != "" {
+					input.Prefix = aws.String(target.Prefix)
+				}
+				if _, err := svc.ListObjectsV2WithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"ListObjectVersions": Action{
+			Description: "Read and enumerate over all versions of objects in bucket, including deleted ones.",
+			Cmd:         "list-object-versions --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.ListObjectVersionsInput{
+					Bucket:  aws.String(target.Bucket),
+					MaxKeys: aws.Int64(2),
+				}
+				if target.Prefix != "" {
+					input.Prefix = aws.String(target.Prefix)
+				}
+				if _, err := svc.ListObjectVersionsWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"ListMultipartUploads": Action{
+			Description: "Read and enumerate over in-progress multipart uploads in bucket.",
+			Cmd:         "list-multipart-uploads --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.ListMultipartUploadsInput{
+					Bucket:     aws.String(target.Bucket),
+					MaxUploads: aws.Int64(2),
+				}
+				if _, err := svc.ListMultipartUploadsWithContext(ctx, input); err != nil {
 					return false
 				}
 				return true
@@ -56,16 +387,18 @@ func NewPlayBook() PlayBook {
 		"PutObject": Action{
 			Description: "Write object to bucket with key.",
 			Cmd:         "put-object --bucket <NAME> --key <KEY> --body <FILE>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryWrite,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 
 				// get MD5 checksum for empty string
 				h := md5.New()
 				content := strings.NewReader("")
 				content.WriteTo(h)
 
+				key := ProbeKey()
 				resp, _ := svc.PutObjectRequest(&s3.PutObjectInput{
-					Bucket: aws.String(name),
-					Key:    aws.String(TempObject),
+					Bucket: aws.String(target.Bucket),
+					Key:    aws.String(key),
 				})
 
 				// configure with MD5 checksum
@@ -80,14 +413,31 @@ func NewPlayBook() PlayBook {
 
 				// send request but with different body to force MD5 check to fail,
 				// thus not modifying the actual contents of the bucket
-				req, err := http.NewRequest("PUT", url, strings.NewReader("CONTENT"))
-				req.Header.Set("Content-MD5", md5s)
+				req, err := http.NewRequestWithContext(ctx, "PUT", url, strings.NewReader("CONTENT"))
 				if err != nil {
 					return false
 				}
+				req.Header.Set("Content-MD5", md5s)
 
 				// a successful upload or a failed MD5 checksum check is fine
-				finalResp, err := http.DefaultClient.Do(req)
+				finalResp, err := NewHTTPClient(0).Do(req)
+				if err != nil {
+					return false
+				}
+				defer finalResp.Body.Close()
+
+				// if the object was actually written, try not to leave it behind
+				if finalResp.StatusCode == 200 {
+					Log.Warnf("Object %s was written to %s, attempting to delete it\n", key, target.Bucket)
+					_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+						Bucket: aws.String(target.Bucket),
+						Key:    aws.String(key),
+					})
+					if err != nil {
+						Log.Errorf("Could not delete %s from %s: %v\n", key, target.Bucket, err)
+					}
+				}
+
 				if finalResp.StatusCode == 200 || finalResp.StatusCode == 400 {
 					return true
 				} else {
@@ -96,16 +446,121 @@ func NewPlayBook() PlayBook {
 			},
 		},
 
+		"DeleteObject": Action{
+			Description: "Delete an object from the bucket. Tested against a random key that doesn't exist, but on a versioned bucket this still leaves a delete marker behind.",
+			Cmd:         "delete-object --bucket <NAME> --key <KEY>",
+			Category:    CategoryWrite,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+
+				// target a key that can't exist so nothing is actually destroyed. S3 doesn't
+				// error on deleting a missing key if permitted, but will deny it otherwise. If
+				// versioning is enabled, a delete marker is still created for the key.
+				input := &s3.DeleteObjectInput{
+					Bucket: aws.String(target.Bucket),
+					Key:    aws.String(ProbeKey()),
+				}
+				if _, err := svc.DeleteObjectWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"GetObject": Action{
+			Description: "Read an object's contents from the bucket.",
+			Cmd:         "get-object --bucket <NAME> --key <KEY> <OUTFILE>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				key, ok := target.ObjectKey(ctx, svc)
+				if !ok {
+					return false
+				}
+
+				// only request the first byte, no need to download the whole object
+				input := &s3.GetObjectInput{
+					Bucket: aws.String(target.Bucket),
+					Key:    aws.String(key),
+					Range:  aws.String("bytes=0-0"),
+				}
+				output, err := svc.GetObjectWithContext(ctx, input)
+				if err != nil {
+					return false
+				}
+				output.Body.Close()
+				return true
+			},
+		},
+
+		"HeadObject": Action{
+			Description: "Read an object's metadata, which may be allowed on known keys even if listing is denied.",
+			Cmd:         "head-object --bucket <NAME> --key <KEY>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				key, ok := target.ObjectKey(ctx, svc)
+				if !ok {
+					return false
+				}
+
+				input := &s3.HeadObjectInput{
+					Bucket: aws.String(target.Bucket),
+					Key:    aws.String(key),
+				}
+				output, err := svc.HeadObjectWithContext(ctx, input)
+				if err != nil {
+					return false
+				}
+
+				// record what the object is, ie. to judge how sensitive it may be
+				target.Record(func(details *BucketDetails) {
+					details.ObjectKey = key
+					details.ObjectSize = output.ContentLength
+					details.ContentType = aws.StringValue(output.ContentType)
+				})
+				return true
+			},
+		},
+
+		"GetObjectAcl": Action{
+			Description: "Read an object's access control list.",
+			Cmd:         "get-object-acl --bucket <NAME> --key <KEY>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				key, ok := target.ObjectKey(ctx, svc)
+				if !ok {
+					return false
+				}
+
+				input := &s3.GetObjectAclInput{
+					Bucket: aws.String(target.Bucket),
+					Key:    aws.String(key),
+				}
+				if _, err := svc.GetObjectAclWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
 		"GetBucketAcl": Action{
 			Description: "Read bucket's access control list.",
 			Cmd:         "get-bucket-acl --bucket <NAME>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				input := &s3.GetBucketAclInput{
-					Bucket: aws.String(name),
+					Bucket: aws.String(target.Bucket),
 				}
-				if _, err := svc.GetBucketAcl(input); err != nil {
+				output, err := svc.GetBucketAclWithContext(ctx, input)
+				if err != nil {
 					return false
 				}
+
+				// record who owns the bucket
+				if output.Owner != nil {
+					target.Record(func(details *BucketDetails) {
+						details.OwnerId = aws.StringValue(output.Owner.ID)
+						details.OwnerName = aws.StringValue(output.Owner.DisplayName)
+					})
+				}
 				return true
 			},
 		},
@@ -113,7 +568,8 @@ func NewPlayBook() PlayBook {
 		"PutBucketAcl": Action{
 			Description: "Write a new access control list for a bucket.",
 			Cmd:         "put-bucket-acl --bucket <NAME> --grant-* <KEY_VALUES>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryWrite,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 
 				// get MD5 checksum for empty string
 				h := md5.New()
@@ -121,7 +577,7 @@ func NewPlayBook() PlayBook {
 				content.WriteTo(h)
 
 				req, _ := svc.PutBucketAclRequest(&s3.PutBucketAclInput{
-					Bucket:    aws.String(name),
+					Bucket:    aws.String(target.Bucket),
 					GrantRead: aws.String("uri=http://acs.amazonaws.com/groups/global/AllUsers"),
 				})
 
@@ -129,6 +585,7 @@ func NewPlayBook() PlayBook {
 				md5s := base64.StdEncoding.EncodeToString(h.Sum(nil))
 				req.HTTPRequest.Header.Set("Content-MD5", md5s)
 
+				req.SetContext(ctx)
 				if err := req.Send(); err != nil {
 					return false
 				}
@@ -136,16 +593,57 @@ func NewPlayBook() PlayBook {
 			},
 		},
 
+		"GetBucketLocation": Action{
+			Description: "Read the region a bucket resides in.",
+			Cmd:         "get-bucket-location --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.GetBucketLocationInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.GetBucketLocationWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
 		"GetBucketPolicy": Action{
 			Description: "Read a bucket's policy.",
 			Cmd:         "get-bucket-policy --bucket <NAME>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				input := &s3.GetBucketPolicyInput{
-					Bucket: aws.String(name),
+					Bucket: aws.String(target.Bucket),
 				}
-				if _, err := svc.GetBucketPolicy(input); err != nil {
+				output, err := svc.GetBucketPolicyWithContext(ctx, input)
+				if err != nil {
 					return false
 				}
+
+				// record statements that grant anything to anyone
+				grants := AnalyzePolicy(aws.StringValue(output.Policy))
+				target.Record(func(details *BucketDetails) {
+					details.PublicGrants = grants
+				})
+				return true
+			},
+		},
+
+		"GetBucketPolicyStatus": Action{
+			Description: "Read whether S3 considers a bucket public based on its policy.",
+			Cmd:         "get-bucket-policy-status --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				public, err := IsBucketPublic(ctx, svc, target.Bucket)
+				if err != nil {
+					return false
+				}
+
+				// record if public, which helps triage whose bucket it is alongside the owner
+				target.Record(func(details *BucketDetails) {
+					details.Public = &public
+				})
 				return true
 			},
 		},
@@ -153,7 +651,8 @@ func NewPlayBook() PlayBook {
 		"PutBucketPolicy": Action{
 			Description: "Write a new policy for the bucket.",
 			Cmd:         "put-bucket-policy --bucket <NAME> --policy <FILE>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryWrite,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				testPolicy := map[string]interface{}{
 					"Version": "2021-01-01",
 					"Statement": []map[string]interface{}{
@@ -165,7 +664,7 @@ func NewPlayBook() PlayBook {
 								"s3:GetObject",
 							},
 							"Resource": []string{
-								fmt.Sprintf("arn:aws:s3:::%s/*", name),
+								fmt.Sprintf("arn:aws:s3:::%s/*", target.Bucket),
 							},
 						},
 					},
@@ -173,10 +672,10 @@ func NewPlayBook() PlayBook {
 
 				policy, _ := json.Marshal(testPolicy)
 				input := &s3.PutBucketPolicyInput{
-					Bucket: aws.String(name),
+					Bucket: aws.String(target.Bucket),
 					Policy: aws.String(string(policy)),
 				}
-				if _, err := svc.PutBucketPolicy(input); err != nil {
+				if _, err := svc.PutBucketPolicyWithContext(ctx, input); err != nil {
 					return false
 				}
 				return true
@@ -186,13 +685,21 @@ func NewPlayBook() PlayBook {
 		"GetBucketCors": Action{
 			Description: "Read a bucket's cross-original resource sharing configuration.",
 			Cmd:         "get-bucket-cors --bucket <NAME>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				input := &s3.GetBucketCorsInput{
-					Bucket: aws.String(name),
+					Bucket: aws.String(target.Bucket),
 				}
-				if _, err := svc.GetBucketCors(input); err != nil {
+				output, err := svc.GetBucketCorsWithContext(ctx, input)
+				if err != nil {
 					return false
 				}
+
+				// record rules that let any origin modify the bucket
+				rules := AnalyzeCors(output.CORSRules)
+				target.Record(func(details *BucketDetails) {
+					details.PermissiveCors = rules
+				})
 				return true
 			},
 		},
@@ -200,9 +707,10 @@ func NewPlayBook() PlayBook {
 		"PutBucketCors": Action{
 			Description: "Read a bucket's cross-original resource sharing configuration.",
 			Cmd:         "put-bucket-cors --bucket <NAME> --cors-configuration <FILE>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryWrite,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				input := &s3.PutBucketCorsInput{}
-				if _, err := svc.PutBucketCors(input); err != nil {
+				if _, err := svc.PutBucketCorsWithContext(ctx, input); err != nil {
 					return false
 				}
 				return true
@@ -212,27 +720,53 @@ func NewPlayBook() PlayBook {
 		"GetBucketLogging": Action{
 			Description: "Gets logging status of bucket and relevant permissions.",
 			Cmd:         "get-bucket-logging --bucket <NAME>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				input := &s3.GetBucketLoggingInput{
-					Bucket: aws.String(name),
+					Bucket: aws.String(target.Bucket),
 				}
-				if _, err := svc.GetBucketLogging(input); err != nil {
+				output, err := svc.GetBucketLoggingWithContext(ctx, input)
+				if err != nil {
 					return false
 				}
+
+				// record where access logs go, since a bucket without them leaves no trail of who accessed it
+				target.Record(func(details *BucketDetails) {
+					enabled := output.LoggingEnabled != nil
+					details.AccessLoggingEnabled = &enabled
+					if enabled {
+						details.LoggingTarget = aws.StringValue(output.LoggingEnabled.TargetBucket)
+						details.LoggingPrefix = aws.StringValue(output.LoggingEnabled.TargetPrefix)
+					}
+				})
 				return true
 			},
 		},
 
 		"GetBucketWebsite": Action{
-			Description: "Gets configuration if S3 bucket is configured to serve a site.",
+			Description: "Gets configuration if S3 bucket is configured to serve a site, and fetches its index document.",
 			Cmd:         "get-bucket-website --bucket <NAME>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				input := &s3.GetBucketWebsiteInput{
-					Bucket: aws.String(name),
+					Bucket: aws.String(target.Bucket),
 				}
-				if _, err := svc.GetBucketWebsite(input); err != nil {
+				if _, err := svc.GetBucketWebsiteWithContext(ctx, input); err != nil {
 					return false
 				}
+
+				// confirm the site is actually served publicly, rather than only configured. The region is
+				// set before any action runs, so it's safe to read without recording.
+				if target.Details != nil && target.Details.Region != NoRegion {
+					endpoint := WebsiteEndpoint(target.Bucket, target.Details.Region)
+					serving, err := IsWebsiteServing(ctx, endpoint)
+					target.Record(func(details *BucketDetails) {
+						details.WebsiteEndpoint = endpoint
+						if err == nil {
+							details.WebsiteServing = &serving
+						}
+					})
+				}
 				return true
 			},
 		},
@@ -240,11 +774,12 @@ func NewPlayBook() PlayBook {
 		"GetBucketVersioning": Action{
 			Description: "Get versioning status of the bucket.",
 			Cmd:         "get-bucket-versioning --bucket <NAME>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				input := &s3.GetBucketVersioningInput{
-					Bucket: aws.String(name),
+					Bucket: aws.String(target.Bucket),
 				}
-				if _, err := svc.GetBucketVersioning(input); err != nil {
+				if _, err := svc.GetBucketVersioningWithContext(ctx, input); err != nil {
 					return false
 				}
 				return true
@@ -254,13 +789,304 @@ func NewPlayBook() PlayBook {
 		"GetBucketEncryption": Action{
 			Description: "Get encryption configuration of bucket, if any.",
 			Cmd:         "get-bucket-encryption --bucket <NAME>",
-			Callback: func(svc s3.S3, name string) bool {
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
 				input := &s3.GetBucketEncryptionInput{
-					Bucket: aws.String(name),
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.GetBucketEncryptionWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"GetBucketTagging": Action{
+			Description: "Read a bucket's tags.",
+			Cmd:         "get-bucket-tagging --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.GetBucketTaggingInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.GetBucketTaggingWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"GetBucketReplication": Action{
+			Description: "Read a bucket's replication configuration, if any.",
+			Cmd:         "get-bucket-replication --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.GetBucketReplicationInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.GetBucketReplicationWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"GetBucketLifecycleConfiguration": Action{
+			Description: "Read a bucket's lifecycle configuration, if any.",
+			Cmd:         "get-bucket-lifecycle-configuration --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.GetBucketLifecycleConfigurationInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.GetBucketLifecycleConfigurationWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"GetBucketOwnershipControls": Action{
+			Description: "Read a bucket's object ownership controls, which govern how ACLs are enforced.",
+			Cmd:         "get-bucket-ownership-controls --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.GetBucketOwnershipControlsInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.GetBucketOwnershipControlsWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"GetBucketNotificationConfiguration": Action{
+			Description: "Read a bucket's event notification configuration, which may reveal Lambda, SQS or SNS targets.",
+			Cmd:         "get-bucket-notification-configuration --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.GetBucketNotificationConfigurationRequest{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.GetBucketNotificationConfigurationWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"ListBucketInventoryConfigurations": Action{
+			Description: "List a bucket's inventory configurations, which reveal where object listings are exported.",
+			Cmd:         "list-bucket-inventory-configurations --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.ListBucketInventoryConfigurationsInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.ListBucketInventoryConfigurationsWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"ListBucketAnalyticsConfigurations": Action{
+			Description: "List a bucket's storage class analytics configurations, which may export data to another bucket.",
+			Cmd:         "list-bucket-analytics-configurations --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.ListBucketAnalyticsConfigurationsInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.ListBucketAnalyticsConfigurationsWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"ListBucketMetricsConfigurations": Action{
+			Description: "List a bucket's request metrics configurations.",
+			Cmd:         "list-bucket-metrics-configurations --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.ListBucketMetricsConfigurationsInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.ListBucketMetricsConfigurationsWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"GetObjectLockConfiguration": Action{
+			Description: "Read a bucket's Object Lock configuration, which indicates whether objects are WORM protected.",
+			Cmd:         "get-object-lock-configuration --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.GetObjectLockConfigurationInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				output, err := svc.GetObjectLockConfigurationWithContext(ctx, input)
+
+				// buckets without Object Lock have no configuration to read, which still means the read was allowed
+				if ErrorCode(err) == "ObjectLockConfigurationNotFoundError" {
+					locked := false
+					target.Record(func(details *BucketDetails) {
+						details.ObjectLock = &locked
+					})
+					return true
+				} else if err != nil {
+					return false
+				}
+
+				if output.ObjectLockConfiguration != nil {
+					locked := aws.StringValue(output.ObjectLockConfiguration.ObjectLockEnabled) == s3.ObjectLockEnabledEnabled
+					target.Record(func(details *BucketDetails) {
+						details.ObjectLock = &locked
+					})
+				}
+				return true
+			},
+		},
+
+		"ListBucketIntelligentTieringConfigurations": Action{
+			Description: "List a bucket's S3 Intelligent-Tiering configurations.",
+			Cmd:         "list-bucket-intelligent-tiering-configurations --bucket <NAME>",
+			Category:    CategoryRead,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+				input := &s3.ListBucketIntelligentTieringConfigurationsInput{
+					Bucket: aws.String(target.Bucket),
+				}
+				if _, err := svc.ListBucketIntelligentTieringConfigurationsWithContext(ctx, input); err != nil {
+					return false
+				}
+				return true
+			},
+		},
+
+		"PutBucketTagging": Action{
+			Description: "Write a new set of tags for the bucket.",
+			Cmd:         "put-bucket-tagging --bucket <NAME> --tagging <TAGSET>",
+			Category:    CategoryWrite,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+
+				// get MD5 checksum for content that differs from the tags sent
+				h := md5.New()
+				content := strings.NewReader("CONTENT")
+				content.WriteTo(h)
+
+				req, _ := svc.PutBucketTaggingRequest(&s3.PutBucketTaggingInput{
+					Bucket: aws.String(target.Bucket),
+					Tagging: &s3.Tagging{
+						TagSet: []*s3.Tag{
+							{
+								Key:   aws.String("slamdunk"),
+								Value: aws.String("slamdunk"),
+							},
+						},
+					},
+				})
+
+				// configure with invalid MD5 checksum to fail actual modification
+				md5s := base64.StdEncoding.EncodeToString(h.Sum(nil))
+				req.HTTPRequest.Header.Set("Content-MD5", md5s)
+
+				// a failed checksum check means the request was authorized
+				req.SetContext(ctx)
+				if err := req.Send(); err != nil {
+					code := ErrorCode(err)
+					return code == "BadDigest" || code == "InvalidDigest"
+				}
+				return true
+			},
+		},
+
+		"PutBucketLifecycleConfiguration": Action{
+			Description: "Write a new lifecycle configuration for the bucket, which can expire objects.",
+			Cmd:         "put-bucket-lifecycle-configuration --bucket <NAME> --lifecycle-configuration <FILE>",
+			Category:    CategoryWrite,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+
+				// get MD5 checksum for content that differs from the configuration sent
+				h := md5.New()
+				content := strings.NewReader("CONTENT")
+				content.WriteTo(h)
+
+				// rule is disabled and scoped to keys we'd create, in case it's ever applied
+				req, _ := svc.PutBucketLifecycleConfigurationRequest(&s3.PutBucketLifecycleConfigurationInput{
+					Bucket: aws.String(target.Bucket),
+					LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
+						Rules: []*s3.LifecycleRule{
+							{
+								ID:     aws.String("slamdunk"),
+								Status: aws.String(s3.ExpirationStatusDisabled),
+								Filter: &s3.LifecycleRuleFilter{
+									Prefix: aws.String(TempObject),
+								},
+								Expiration: &s3.LifecycleExpiration{
+									Days: aws.Int64(1),
+								},
+							},
+						},
+					},
+				})
+
+				// configure with invalid MD5 checksum to fail actual modification
+				md5s := base64.StdEncoding.EncodeToString(h.Sum(nil))
+				req.HTTPRequest.Header.Set("Content-MD5", md5s)
+
+				// a failed checksum check means the request was authorized
+				req.SetContext(ctx)
+				if err := req.Send(); err != nil {
+					code := ErrorCode(err)
+					return code == "BadDigest" || code == "InvalidDigest"
+				}
+				return true
+			},
+		},
+
+		"DeleteBucketPolicy": Action{
+			Description: "Delete a bucket's policy. DESTRUCTIVE: the policy is actually deleted if allowed and restored afterwards, skipped if it can't be read first.",
+			Cmd:         "delete-bucket-policy --bucket <NAME>",
+			Category:    CategoryDestructive,
+			Destructive: true,
+			Callback: func(ctx aws.Context, svc s3.S3, target *Target) bool {
+
+				// there's no way to fail the deletion on purpose, so save the policy to restore it afterwards. A
+				// bucket without a policy has nothing to lose, but one whose policy can't be read isn't touched.
+				policy, err := svc.GetBucketPolicyWithContext(ctx, &s3.GetBucketPolicyInput{
+					Bucket: aws.String(target.Bucket),
+				})
+				if err != nil && ErrorCode(err) != "NoSuchBucketPolicy" {
+					Log.Warnf("Not deleting the policy of %s, as it couldn't be read to restore: %v\n", target.Bucket, err)
+					target.Error("DeleteBucketPolicy", fmt.Errorf("Policy couldn't be read to restore, so it wasn't deleted: %w", err))
+					return false
 				}
-				if _, err := svc.GetBucketEncryption(input); err != nil {
+
+				_, delErr := svc.DeleteBucketPolicyWithContext(ctx, &s3.DeleteBucketPolicyInput{
+					Bucket: aws.String(target.Bucket),
+				})
+				if delErr != nil {
 					return false
 				}
+
+				if err == nil && policy.Policy != nil {
+					Log.Warnf("Deleted the policy of %s, attempting to restore it\n", target.Bucket)
+
+					// the action's context may have run out during the deletion, so restore with a fresh one
+					restoreCtx, cancel := context.WithTimeout(context.Background(), RestoreTimeout)
+					defer cancel()
+					_, err := svc.PutBucketPolicyWithContext(restoreCtx, &s3.PutBucketPolicyInput{
+						Bucket: aws.String(target.Bucket),
+						Policy: policy.Policy,
+					})
+					if err != nil {
+						Log.Errorf("Could not restore the policy of %s: %v\n", target.Bucket, err)
+					}
+				}
 				return true
 			},
 		},
@@ -268,3 +1094,68 @@ func NewPlayBook() PlayBook {
 		// GetBucketPublicAccessBlock
 	}
 }
+
+// Describes a playbook file, which references built-in actions by name since callbacks can't be serialized.
+type playbookFile struct {
+	Actions []playbookEntry `json:"actions" yaml:"actions"`
+}
+
+type playbookEntry struct {
+	// name of a built-in action
+	Name string `json:"name" yaml:"name"`
+
+	// if explicitly set to false, the action is left out of the playbook
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+
+	// if set, replaces the built-in description
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// Load a playbook from a YAML or JSON file listing the built-in actions to run, ie.
+//
+//    actions:
+//      - name: ListObjects
+//      - name: GetBucketPolicy
+//        description: Read the bucket policy.
+//      - name: PutObject
+//        enabled: false
+//
+// The format is picked by the file's extension, which must be one of .yaml, .yml or .json.
+func LoadPlaybook(path string) (PlayBook, error) {
+	var unmarshal func([]byte, interface{}) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	case ".json":
+		unmarshal = json.Unmarshal
+	default:
+		return nil, fmt.Errorf("Playbook file %s must be YAML or JSON, with a .yaml, .yml or .json extension.", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file playbookFile
+	if err := unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	builtin := NewPlayBook()
+	playbook := PlayBook{}
+	for _, entry := range file.Actions {
+		action, ok := builtin[entry.Name]
+		if !ok {
+			return nil, fmt.Errorf("Cannot find action %s from playbook file.", entry.Name)
+		}
+		if entry.Enabled != nil && !*entry.Enabled {
+			continue
+		}
+		if entry.Description != "" {
+			action.Description = entry.Description
+		}
+		playbook[entry.Name] = action
+	}
+	return playbook, nil
+}
@@ -0,0 +1,114 @@
+package slamdunk
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestActionClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		action Action
+		want   ActionCategory
+	}{
+		{"GetBucketAcl", Action{Category: CategoryRead}, CategoryRead},
+		{"PutBucketAcl", Action{}, CategoryWrite},
+		{"GetBucketTagging", Action{}, CategoryRead},
+		{"DeleteBucket", Action{Destructive: true}, CategoryDestructive},
+		{"WipeBucket", Action{Category: CategoryRead, Destructive: true}, CategoryDestructive},
+	}
+	for _, test := range tests {
+		if got := test.action.Classify(test.name); got != test.want {
+			t.Errorf("Classify(%s) = %s, want %s", test.name, got, test.want)
+		}
+		info := test.action.Info(test.name)
+		if info.Destructive != (test.want == CategoryDestructive) {
+			t.Errorf("Info(%s) reports destructive %t for category %s", test.name, info.Destructive, test.want)
+		}
+	}
+}
+
+func TestLoadPlaybook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slamdunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlContents := `actions:
+  - name: ListObjects
+    description: List keys.
+  - name: PutObject
+    enabled: false
+`
+	jsonContents := `{"actions": [{"name": "ListObjects", "description": "List keys."}, {"name": "PutObject", "enabled": false}]}`
+	tests := []struct {
+		name     string
+		contents string
+		ok       bool
+	}{
+		{"playbook.yaml", yamlContents, true},
+		{"playbook.yml", yamlContents, true},
+		{"playbook.json", jsonContents, true},
+		{"playbook.txt", jsonContents, false},
+		{"invalid.yaml", "actions: [", false},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(path, []byte(test.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		playbook, err := LoadPlaybook(path)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("LoadPlaybook(%s) should have failed", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("LoadPlaybook(%s) failed: %v", test.name, err)
+		}
+		action, ok := playbook["ListObjects"]
+		if !ok || len(playbook) != 1 {
+			t.Errorf("LoadPlaybook(%s) = %v, want only ListObjects", test.name, playbook)
+		} else if action.Description != "List keys." {
+			t.Errorf("LoadPlaybook(%s) described ListObjects as %q, want the description from the file", test.name, action.Description)
+		}
+	}
+}
+
+// Actions run concurrently, so errors and details they record must all land without racing each other.
+func TestTargetRecordConcurrently(t *testing.T) {
+	target := &Target{Bucket: "bucket", Details: &BucketDetails{}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			target.Error(fmt.Sprintf("Action%d", i), errors.New("context deadline exceeded"))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			public := i%2 == 0
+			target.Record(func(details *BucketDetails) {
+				details.Public = &public
+				details.SampleKeys = append(details.SampleKeys, fmt.Sprintf("key-%d", i))
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	if len(target.Details.Errors) != 20 || len(target.Details.SampleKeys) != 20 {
+		t.Errorf("recorded %d errors and %d keys, want 20 of each", len(target.Details.Errors), len(target.Details.SampleKeys))
+	}
+
+	// recording without details to record into is a no-op
+	(&Target{}).Error("GetObject", errors.New("timed out"))
+}
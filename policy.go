@@ -0,0 +1,159 @@
+package slamdunk
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Statement in a bucket policy that allows anyone to perform actions on the bucket.
+type PublicGrant struct {
+	// statement ID, if the statement has one
+	Sid string `json:"sid,omitempty"`
+
+	// actions granted to anyone, ie. `s3:GetObject`
+	Actions []string `json:"actions"`
+
+	// resources the actions are granted on
+	Resources []string `json:"resources"`
+
+	// set if the statement has conditions, which may limit who can actually use the grant
+	Conditional bool `json:"conditional"`
+}
+
+// CORS rule that lets any origin make requests which modify a bucket's contents.
+type PermissiveCorsRule struct {
+	// rule ID, if the rule has one
+	Id string `json:"id,omitempty"`
+
+	// origins allowed, which include `*`
+	AllowedOrigins []string `json:"allowedOrigins"`
+
+	// methods allowed, which include at least one that isn't read-only, ie. `PUT`
+	AllowedMethods []string `json:"allowedMethods"`
+}
+
+// Methods that only read from a bucket, which are commonly allowed from any origin for serving public assets
+var readOnlyCorsMethods = map[string]bool{
+	"GET":  true,
+	"HEAD": true,
+}
+
+// Find every CORS rule allowing any origin to use a method that isn't read-only, ie. `PUT` or `DELETE`.
+func AnalyzeCors(rules []*s3.CORSRule) []PermissiveCorsRule {
+	permissive := []PermissiveCorsRule{}
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+
+		origins := aws.StringValueSlice(rule.AllowedOrigins)
+		wildcard := false
+		for _, origin := range origins {
+			if origin == "*" {
+				wildcard = true
+			}
+		}
+		if !wildcard {
+			continue
+		}
+
+		methods := aws.StringValueSlice(rule.AllowedMethods)
+		for _, method := range methods {
+			if !readOnlyCorsMethods[strings.ToUpper(method)] {
+				permissive = append(permissive, PermissiveCorsRule{
+					Id:             aws.StringValue(rule.ID),
+					AllowedOrigins: origins,
+					AllowedMethods: methods,
+				})
+				break
+			}
+		}
+	}
+	return permissive
+}
+
+// Unmarshals policy fields that can either be a single string or a list of them
+type stringOrList []string
+
+func (s *stringOrList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = []string{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+type policyStatement struct {
+	Sid       string                 `json:"Sid"`
+	Effect    string                 `json:"Effect"`
+	Principal json.RawMessage        `json:"Principal"`
+	Action    stringOrList           `json:"Action"`
+	Resource  stringOrList           `json:"Resource"`
+	Condition map[string]interface{} `json:"Condition"`
+}
+
+type policyDocument struct {
+	Statement json.RawMessage `json:"Statement"`
+}
+
+// Helper that checks if a statement's principal is anyone, ie. `"*"` or `{"AWS": "*"}`.
+func isPublicPrincipal(principal json.RawMessage) bool {
+	var single string
+	if err := json.Unmarshal(principal, &single); err == nil {
+		return single == "*"
+	}
+
+	var principals map[string]stringOrList
+	if err := json.Unmarshal(principal, &principals); err != nil {
+		return false
+	}
+	for _, value := range principals["AWS"] {
+		if value == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse a bucket policy document and find every statement allowing anyone to perform actions. Malformed
+// documents have no grants.
+func AnalyzePolicy(doc string) []PublicGrant {
+	grants := []PublicGrant{}
+
+	var policy policyDocument
+	if err := json.Unmarshal([]byte(doc), &policy); err != nil {
+		return grants
+	}
+
+	// a single statement doesn't have to be in a list
+	statements := []policyStatement{}
+	if err := json.Unmarshal(policy.Statement, &statements); err != nil {
+		var statement policyStatement
+		if err := json.Unmarshal(policy.Statement, &statement); err != nil {
+			return grants
+		}
+		statements = append(statements, statement)
+	}
+
+	for _, statement := range statements {
+		if statement.Effect != "Allow" || !isPublicPrincipal(statement.Principal) {
+			continue
+		}
+		grants = append(grants, PublicGrant{
+			Sid:         statement.Sid,
+			Actions:     statement.Action,
+			Resources:   statement.Resource,
+			Conditional: len(statement.Condition) != 0,
+		})
+	}
+	return grants
+}
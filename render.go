@@ -0,0 +1,222 @@
+package slamdunk
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Formats that audit results can be rendered as
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// Renders the results of an audit into a specific output format.
+type Renderer interface {
+	Render(audit Audit) ([]byte, error)
+}
+
+// Create a renderer for a format, which also includes the details recorded by the auditor, ie. for buckets
+// that failed to be audited.
+func (a *Auditor) Renderer(format string) (Renderer, error) {
+	switch format {
+	case FormatTable, "":
+		return &TableRenderer{auditor: a}, nil
+	case FormatJSON:
+		return &JSONRenderer{auditor: a}, nil
+	case FormatCSV:
+		return &CSVRenderer{auditor: a}, nil
+	case FormatMarkdown:
+		return &MarkdownRenderer{auditor: a}, nil
+	}
+	return nil, errors.New("Unsupported output format, must be one of table, json, csv or markdown.")
+}
+
+// Renders the human-readable summary of permissions and details for each bucket.
+type TableRenderer struct {
+	auditor *Auditor
+}
+
+func (r *TableRenderer) Render(audit Audit) ([]byte, error) {
+	var buf bytes.Buffer
+	r.auditor.summarize(&buf, audit)
+	return buf.Bytes(), nil
+}
+
+// Renders a list of every bucket with each action tested and whether it was allowed, along with the details
+// recorded for it, in the same form as the evidence files written by `OutputDir`.
+type JSONRenderer struct {
+	auditor *Auditor
+}
+
+func (r *JSONRenderer) Render(audit Audit) ([]byte, error) {
+	buckets, details := r.auditor.renderedBuckets(audit)
+	evidence := []bucketEvidence{}
+	for _, bucket := range buckets {
+		permissions, ok := audit[bucket]
+		if !ok {
+			permissions = map[string]bool{}
+		}
+		evidence = append(evidence, bucketEvidence{
+			Bucket:      bucket,
+			Permissions: permissions,
+			Details:     details[bucket],
+		})
+	}
+	return json.MarshalIndent(evidence, "", "  ")
+}
+
+// Renders a row for every action tested against each bucket, alongside the bucket's status, owner, whether
+// it's public and what its policy grants to anyone. Buckets that failed to be audited get a single row without
+// an action.
+type CSVRenderer struct {
+	auditor *Auditor
+}
+
+func (r *CSVRenderer) Render(audit Audit) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	header := []string{"Bucket", "Action", "Allowed", "Status", "Reason", "Owner", "Public", "Public Policy"}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	buckets, details := r.auditor.renderedBuckets(audit)
+	for _, bucket := range buckets {
+		info := []string{"", "", "", "", ""}
+		if detail, ok := details[bucket]; ok {
+			info = []string{string(detail.Status), detail.Reason, ownerString(detail), publicString(detail), grantsString(detail.PublicGrants)}
+		}
+
+		actions, ok := audit[bucket]
+		if !ok {
+			if err := writer.Write(append([]string{bucket, "", ""}, info...)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, action := range sortedActions(actions, false) {
+			row := append([]string{bucket, action, fmt.Sprintf("%t", actions[action])}, info...)
+			if err := writer.Write(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// Renders a Markdown table of the permissions granted on each bucket with its status, owner, whether it's
+// public and what its policy grants to anyone, ie. for pasting into reports.
+type MarkdownRenderer struct {
+	auditor *Auditor
+}
+
+func (r *MarkdownRenderer) Render(audit Audit) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("| Bucket | Status | Owner | Public | Read | Write | Public Policy |\n")
+	buf.WriteString("|--------|--------|-------|--------|------|-------|---------------|\n")
+
+	buckets, details := r.auditor.renderedBuckets(audit)
+	for _, bucket := range buckets {
+		readPerms := []string{}
+		writePerms := []string{}
+		for _, perm := range sortedActions(audit[bucket], true) {
+			if IsWriteAction(perm) {
+				writePerms = append(writePerms, perm)
+			} else {
+				readPerms = append(readPerms, perm)
+			}
+		}
+
+		status, owner, public, grants := "", "", "", ""
+		if detail, ok := details[bucket]; ok {
+			status = string(detail.Status)
+			if detail.Reason != "" {
+				status = fmt.Sprintf("%s (%s)", detail.Status, detail.Reason)
+			}
+			owner, public, grants = ownerString(detail), publicString(detail), grantsString(detail.PublicGrants)
+		}
+		fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s | %s | %s |\n", bucket, markdownEscape(status), markdownEscape(owner),
+			public, strings.Join(readPerms, ", "), strings.Join(writePerms, ", "), markdownEscape(grants))
+	}
+	return buf.Bytes(), nil
+}
+
+// Helper that gets the buckets in an audit along with those that failed or were skipped in a stable order, and
+// copies of the details recorded for each, which are safe to read while buckets are still being audited.
+func (a *Auditor) renderedBuckets(audit Audit) ([]string, map[string]*BucketDetails) {
+	details := a.SnapshotDetails()
+	all := Audit{}
+	for bucket := range audit {
+		all[bucket] = nil
+	}
+	for bucket := range details {
+		all[bucket] = nil
+	}
+	return sortedBuckets(all), details
+}
+
+// Helper that formats the owner of a bucket, if its ACL could be read.
+func ownerString(details *BucketDetails) string {
+	if details.OwnerId == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", details.OwnerName, details.OwnerId)
+}
+
+// Helper that formats whether S3 considers a bucket public, which is empty if unknown.
+func publicString(details *BucketDetails) string {
+	if details.Public == nil {
+		return ""
+	}
+	return fmt.Sprintf("%t", *details.Public)
+}
+
+// Helper that formats the statements in a bucket policy granting actions to anyone.
+func grantsString(grants []PublicGrant) string {
+	statements := []string{}
+	for _, grant := range grants {
+		statement := fmt.Sprintf("%s on %s", strings.Join(grant.Actions, ", "), strings.Join(grant.Resources, ", "))
+		if grant.Conditional {
+			statement += " (conditional)"
+		}
+		statements = append(statements, statement)
+	}
+	return strings.Join(statements, "; ")
+}
+
+// Helper that escapes pipes so a value can't break out of a Markdown table cell.
+func markdownEscape(value string) string {
+	return strings.ReplaceAll(value, "|", "\\|")
+}
+
+// Helper that gets the buckets in an audit in a stable order.
+func sortedBuckets(audit Audit) []string {
+	buckets := []string{}
+	for bucket := range audit {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+// Helper that gets the actions tested against a bucket in a stable order, optionally only those allowed.
+func sortedActions(results map[string]bool, allowed bool) []string {
+	actions := []string{}
+	for action, result := range results {
+		if allowed && !result {
+			continue
+		}
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
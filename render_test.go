@@ -0,0 +1,108 @@
+package slamdunk
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func renderAuditor() *Auditor {
+	public := true
+	return &Auditor{
+		Results: Audit{
+			"open-bucket": {"ListObjects": true, "PutObject": false},
+		},
+		Details: map[string]*BucketDetails{
+			"open-bucket": {
+				Status:    StatusAccessible,
+				OwnerId:   "abc123",
+				OwnerName: "owner",
+				Public:    &public,
+				PublicGrants: []PublicGrant{
+					{Actions: []string{"s3:GetObject"}, Resources: []string{"arn:aws:s3:::open-bucket/*"}},
+				},
+			},
+			"broken-bucket": {Status: StatusFailed, Reason: "timed out"},
+		},
+	}
+}
+
+func TestRenderJSONDetails(t *testing.T) {
+	auditor := renderAuditor()
+	renderer, err := auditor.Renderer(FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := renderer.Render(auditor.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var evidence []bucketEvidence
+	if err := json.Unmarshal(data, &evidence); err != nil {
+		t.Fatal(err)
+	}
+	if len(evidence) != 2 || evidence[0].Bucket != "broken-bucket" || evidence[1].Bucket != "open-bucket" {
+		t.Fatalf("rendered %v, want the failed and audited buckets", evidence)
+	}
+	if evidence[0].Details == nil || evidence[0].Details.Status != StatusFailed {
+		t.Errorf("failed bucket rendered without its status: %+v", evidence[0].Details)
+	}
+	open := evidence[1].Details
+	if open == nil || open.OwnerId != "abc123" || open.Public == nil || !*open.Public || len(open.PublicGrants) != 1 {
+		t.Errorf("audited bucket rendered without its details: %+v", open)
+	}
+}
+
+func TestRenderCSVDetails(t *testing.T) {
+	auditor := renderAuditor()
+	renderer, err := auditor.Renderer(FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := renderer.Render(auditor.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Bucket", "Action", "Allowed", "Status", "Reason", "Owner", "Public", "Public Policy"},
+		{"broken-bucket", "", "", "failed", "timed out", "", "", ""},
+		{"open-bucket", "ListObjects", "true", "accessible", "", "owner (abc123)", "true", "s3:GetObject on arn:aws:s3:::open-bucket/*"},
+		{"open-bucket", "PutObject", "false", "accessible", "", "owner (abc123)", "true", "s3:GetObject on arn:aws:s3:::open-bucket/*"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("rendered %d rows, want %d: %v", len(rows), len(want), rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %v, want %v", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestRenderMarkdownDetails(t *testing.T) {
+	auditor := renderAuditor()
+	renderer, err := auditor.Renderer(FormatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := renderer.Render(auditor.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"| broken-bucket | failed (timed out) |  |  |  |  |  |",
+		"| open-bucket | accessible | owner (abc123) | true | ListObjects |  | s3:GetObject on arn:aws:s3:::open-bucket/* |",
+	} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("rendered markdown missing %q:\n%s", line, data)
+		}
+	}
+}
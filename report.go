@@ -0,0 +1,172 @@
+package slamdunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Single row in the HTML report
+type reportRow struct {
+	Bucket string
+	Region string
+	Read   string
+	Write  string
+	Public bool
+
+	// one of `writable`, `readable` or `locked`, used for color-coding
+	Class string
+}
+
+// Data consumed by the report template
+type reportData struct {
+	Generated string
+	Rows      []reportRow
+}
+
+// Standalone page with everything inlined, so the report can be shared as a single file
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>slamdunk report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 6px 10px; text-align: left; }
+th { background: #333; color: #fff; cursor: pointer; user-select: none; }
+tr.writable td, tr.public td { background: #f8d7da; }
+tr.readable td { background: #fff3cd; }
+tr.locked td { background: #d4edda; }
+</style>
+</head>
+<body>
+<h1>slamdunk report</h1>
+<p>Generated {{.Generated}}. Click a column header to sort.</p>
+<table id="results">
+<thead>
+<tr><th>Bucket</th><th>Region</th><th>Read</th><th>Write</th><th>Public</th></tr>
+</thead>
+<tbody>
+{{range .Rows}}<tr class="{{.Class}}{{if .Public}} public{{end}}"><td>{{.Bucket}}</td><td>{{.Region}}</td><td>{{.Read}}</td><td>{{.Write}}</td><td>{{.Public}}</td></tr>
+{{end}}</tbody>
+</table>
+<script>
+document.querySelectorAll("#results th").forEach(function(th, idx) {
+  var asc = true;
+  th.addEventListener("click", function() {
+    var body = document.querySelector("#results tbody");
+    var rows = Array.prototype.slice.call(body.rows);
+    rows.sort(function(a, b) {
+      var x = a.cells[idx].textContent, y = b.cells[idx].textContent;
+      return asc ? x.localeCompare(y) : y.localeCompare(x);
+    });
+    asc = !asc;
+    rows.forEach(function(row) { body.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// Render a self-contained HTML report of the permissions granted on each bucket, where buckets that are
+// writable or public are highlighted red and ones that are locked down green. Details are optional.
+func NewHTMLReport(audit Audit, details map[string]*BucketDetails) ([]byte, error) {
+	data := reportData{
+		Generated: time.Now().Format(time.RFC1123),
+		Rows:      []reportRow{},
+	}
+	for _, bucket := range sortedBuckets(audit) {
+		readPerms := []string{}
+		writePerms := []string{}
+		for _, perm := range sortedActions(audit[bucket], true) {
+			if IsWriteAction(perm) {
+				writePerms = append(writePerms, perm)
+			} else {
+				readPerms = append(readPerms, perm)
+			}
+		}
+
+		row := reportRow{
+			Bucket: bucket,
+			Region: NoRegion,
+			Read:   strings.Join(readPerms, ", "),
+			Write:  strings.Join(writePerms, ", "),
+			Class:  "locked",
+		}
+		if len(writePerms) != 0 {
+			row.Class = "writable"
+		} else if len(readPerms) != 0 {
+			row.Class = "readable"
+		}
+		if detail, ok := details[bucket]; ok {
+			row.Region = detail.Region
+			row.Public = detail.Public != nil && *detail.Public
+		}
+		data.Rows = append(data.Rows, row)
+	}
+
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Write the results for all buckets analyzed as a HTML report to a filepath.
+func (a *Auditor) OutputHTML(path string) error {
+	data, err := NewHTMLReport(a.Snapshot(), a.SnapshotDetails())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Evidence stored for a single bucket, with every action tested and the details recorded while auditing
+type bucketEvidence struct {
+	Bucket      string          `json:"bucket"`
+	Permissions map[string]bool `json:"permissions"`
+	Details     *BucketDetails  `json:"details,omitempty"`
+}
+
+// Write a `<bucket>.json` evidence file for every bucket analyzed into a directory, creating it if missing.
+// Buckets that failed to be audited are still written, with only their details set.
+func (a *Auditor) OutputDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	audit, details := a.Snapshot(), a.SnapshotDetails()
+	buckets := map[string]bool{}
+	for bucket := range audit {
+		buckets[bucket] = true
+	}
+	for bucket := range details {
+		buckets[bucket] = true
+	}
+
+	for bucket := range buckets {
+		permissions, ok := audit[bucket]
+		if !ok {
+			permissions = map[string]bool{}
+		}
+		data, err := json.MarshalIndent(bucketEvidence{
+			Bucket:      bucket,
+			Permissions: permissions,
+			Details:     details[bucket],
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, bucket+".json"), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
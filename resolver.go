@@ -2,16 +2,23 @@ package slamdunk
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strconv"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/beevik/etree"
@@ -23,24 +30,98 @@ const (
 	NoRegion   = "No region found"
 )
 
+// Cloud providers that a URL can be resolved to
+const (
+	NoProvider    = "Unknown"
+	ProviderAWS   = "AWS"
+	ProviderAzure = "Azure"
+)
+
 // Result status for a given target URL
 type ResolverStatus struct {
 	// original url
-	Url string
+	Url string `json:"url"`
 
 	// resolved bucket name, if found.
-	Bucket string
+	Bucket string `json:"bucket"`
 
 	// bucket region, if found
-	Region string
+	Region string `json:"region"`
+
+	// cloud provider the bucket is hosted on, if found
+	Provider string `json:"provider"`
 
 	// set if bucket takeover is possible
-	Takeover bool
+	Takeover bool `json:"takeover"`
+
+	// set if the orphaned bucket name was confirmed to be unclaimed in every region
+	Claimable bool `json:"claimable"`
+
+	// set if every subdomain of the URL's parent domain resolves the same, so matches on it aren't trusted
+	WildcardDetected bool `json:"wildcard"`
+
+	// why the URL couldn't be processed, which is the kind of failure it was, only set if it failed
+	Reason string `json:"reason,omitempty"`
+}
+
+// Kinds of failures when resolving a URL, which errors returned by `Resolve` can be checked against with `errors.Is`
+var (
+	ErrDNS         = errors.New("dns lookup failed")
+	ErrTimeout     = errors.New("timed out")
+	ErrConnection  = errors.New("connection failed")
+	ErrTLS         = errors.New("tls verification failed")
+	ErrUnsupported = errors.New("unsupported url")
+	ErrRequest     = errors.New("request failed")
+)
+
+// Error returned when a URL couldn't be resolved, with the check that failed and the kind of failure it was.
+// The underlying error is still available with `errors.As` or `errors.Unwrap`.
+type ResolveError struct {
+	Url   string
+	Check string
+	Kind  error
+	Err   error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("Resolving %s failed at %s (%s): %s", e.Url, e.Check, e.Kind, e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// Lets `errors.Is` match the kind of failure, ie. `errors.Is(err, ErrTimeout)`.
+func (e *ResolveError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Helper that classifies why a request to a URL failed into one of the kinds of failures.
+func errorKind(err error) error {
+	var dnsErr *net.DNSError
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalidCert x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var recordHeader tls.RecordHeaderError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &dnsErr):
+		return ErrDNS
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalidCert), errors.As(err, &hostname),
+		errors.As(err, &recordHeader):
+		return ErrTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrTimeout
+	case errors.Is(err, syscall.ECONNREFUSED), errors.As(err, &opErr):
+		return ErrConnection
+	}
+	return ErrRequest
 }
 
 // Given a returned status, create an entry that can be used for display as a row in an ASCII table
 func (r *ResolverStatus) Row() []string {
-	return []string{r.Url, r.Bucket, r.Region, strconv.FormatBool(r.Takeover)}
+	return []string{r.Url, r.Bucket, r.Region, r.Provider, strconv.FormatBool(r.Takeover), strconv.FormatBool(r.Claimable)}
 }
 
 type Resolver struct {
@@ -58,16 +139,371 @@ type Resolver struct {
 
 	// how many endpoints can be taken over
 	TakeoverPossible int
+
+	// how long to wait on a URL before giving up on it
+	Timeout time.Duration
+
+	// number of URLs resolved at once by `ResolveAll` when it isn't given a concurrency
+	Concurrency int
+
+	// if set, only buckets hosted on these providers are resolved, ie. `aws` or `azure`
+	Providers []string
+
+	// DNS resolver used for CNAME and host lookups, the system resolver if nil
+	DNS *net.Resolver
+
+	// how long to wait on a single DNS lookup before giving up on it, or 0 for no limit
+	DNSTimeout time.Duration
+
+	// if set, only these regions are probed when checking if a bucket exists without a known region
+	Regions []string
+
+	// if set, credentials used when checking if buckets exist, ie. for buckets that only the account can see
+	Config *SessionConfig
+
+	// if set, called with each status as soon as its URL is resolved, ie. for streaming results
+	OnResolve func(ResolverStatus)
+
+	// if set, called once for each URL `ResolveAll` finishes with, whether or not a status was stored for it
+	OnProgress func()
+
+	// if set, only entries vulnerable to takeover are displayed and written out, while stats still count all
+	OnlyTakeover bool
+
+	// if set, only the first URL resolving to each bucket is displayed, instead of a row per URL
+	Dedupe bool
+
+	// if set, URLs that failed to process are displayed with the reason why
+	ShowFailures bool
+
+	// CNAME a random subdomain of each parent domain resolves to, or empty if it doesn't resolve
+	wildcards map[string]string
+
+	// guards counters and buckets when resolving concurrently
+	mu sync.Mutex
+}
+
+// Default time to wait on a URL to respond
+const DefaultTimeout = 3 * time.Second
+
+// Configures a resolver when it is instantiated
+type ResolverOption func(*Resolver)
+
+// Wait on each URL up to a specific timeout, ie. for slow sites behind CDNs.
+func WithTimeout(timeout time.Duration) ResolverOption {
+	return func(r *Resolver) {
+		r.Timeout = timeout
+	}
+}
+
+// Resolve a number of URLs at once by default when resolving in bulk.
+func WithConcurrency(concurrency int) ResolverOption {
+	return func(r *Resolver) {
+		r.Concurrency = concurrency
+	}
+}
+
+// Only resolve buckets hosted on the given providers, matched case-insensitively, ie. `aws` or `azure`.
+func WithProviders(providers ...string) ResolverOption {
+	return func(r *Resolver) {
+		r.Providers = providers
+	}
+}
+
+// Look up CNAMEs and hosts with a specific DNS resolver instead of the system one, ie. from `NewDNSResolver`.
+func WithDNSResolver(dns *net.Resolver) ResolverOption {
+	return func(r *Resolver) {
+		r.DNS = dns
+	}
 }
 
-func NewResolver() *Resolver {
-	return &Resolver{
+// Wait on each DNS lookup up to a specific timeout, ie. to avoid hanging on a slow local resolver.
+func WithDNSTimeout(timeout time.Duration) ResolverOption {
+	return func(r *Resolver) {
+		r.DNSTimeout = timeout
+	}
+}
+
+// Create a DNS resolver that sends every query to a specific server, ie. `8.8.8.8` or `1.1.1.1:53`.
+func NewDNSResolver(server string) *net.Resolver {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// Instantiate a resolver, where no options waits on URLs up to the default timeout and resolves them serially
+// across every provider.
+func NewResolver(opts ...ResolverOption) *Resolver {
+	resolver := &Resolver{
 		Buckets:          []ResolverStatus{},
 		UrlsProcessed:    0,
 		UrlsFailed:       0,
 		Endpoints:        0,
 		TakeoverPossible: 0,
+		Timeout:          DefaultTimeout,
+		Concurrency:      1,
+	}
+	for _, opt := range opts {
+		opt(resolver)
+	}
+	return resolver
+}
+
+// Instantiate a resolver that waits on each URL up to a specific timeout, ie. for slow sites behind CDNs.
+func NewResolverWithTimeout(timeout time.Duration) *Resolver {
+	return NewResolver(WithTimeout(timeout))
+}
+
+// Helper that creates a context bounding a single DNS lookup by the configured timeout, if any.
+func (r *Resolver) dnsContext() (context.Context, context.CancelFunc) {
+	if r.DNSTimeout > 0 {
+		return context.WithTimeout(context.Background(), r.DNSTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Traverse a CNAME chain with the configured DNS resolver.
+func (r *Resolver) cname(url string) (string, error) {
+	ctx, cancel := r.dnsContext()
+	defer cancel()
+	return LookupCNAME(ctx, r.DNS, url)
+}
+
+// Resolve a host to its addresses with the configured DNS resolver.
+func (r *Resolver) lookupHost(host string) ([]string, error) {
+	ctx, cancel := r.dnsContext()
+	defer cancel()
+	dns := r.DNS
+	if dns == nil {
+		dns = net.DefaultResolver
+	}
+	return dns.LookupHost(ctx, host)
+}
+
+// Check if a URL's parent domain has wildcard DNS, by probing a random subdomain that shouldn't exist and
+// checking if it resolves to the same CNAME as the URL. Probes are cached per parent domain.
+func (r *Resolver) wildcard(url string, cname string) bool {
+	labels := strings.SplitN(url, ".", 2)
+	if cname == "" || len(labels) != 2 || !strings.Contains(labels[1], ".") {
+		return false
+	}
+	parent := labels[1]
+
+	r.mu.Lock()
+	probed, ok := r.wildcards[parent]
+	r.mu.Unlock()
+	if !ok {
+		Log.Debugf("Probing %s for wildcard DNS\n", parent)
+		probed, _ = r.cname(ProbeKey() + "." + parent)
+
+		r.mu.Lock()
+		if r.wildcards == nil {
+			r.wildcards = map[string]string{}
+		}
+		r.wildcards[parent] = probed
+		r.mu.Unlock()
+	}
+	return probed == cname
+}
+
+// Check if buckets hosted on a provider should be resolved, which is every provider if none were selected.
+func (r *Resolver) enabled(provider string) bool {
+	if len(r.Providers) == 0 || provider == NoProvider {
+		return true
+	}
+	for _, selected := range r.Providers {
+		if strings.EqualFold(selected, provider) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a bucket exists, only probing the configured regions if the region isn't known.
+func (r *Resolver) exists(ctx context.Context, bucket string, region string) (bool, string, error) {
+	if region == NoRegion || region == "" {
+		return CheckBucketExistsIn(ctx, r.Config, bucket, r.Regions)
+	}
+	return CheckBucketExists(ctx, r.Config, bucket, region)
+}
+
+// Helper that confirms a bucket name flagged for takeover is actually unclaimed, rather than only missing
+// from the region of the endpoint that was hit. Any error other than the bucket not being found is treated
+// as inconclusive, so the name is not reported as claimable.
+func (r *Resolver) claimable(ctx context.Context, bucket string) bool {
+	if bucket == NoBucket || bucket == SomeBucket {
+		return false
+	}
+
+	Log.Debugf("Checking if bucket %s is claimable\n", bucket)
+	exists, _, err := CheckBucketExists(ctx, r.Config, bucket, NoRegion)
+	if exists {
+		return false
+	}
+	code := ErrorCode(err)
+	return code == "NotFound" || code == "NoSuchBucket"
+}
+
+// Store the status of a URL that failed with the kind of failure as the reason why, returning the error to report.
+func (r *Resolver) fail(status ResolverStatus, err *ResolveError) error {
+	status.Reason = err.Kind.Error()
+	r.add(status)
+	return err
+}
+
+// Safely store and count a status for a resolved URL, unless it was resolved to a provider that wasn't
+// selected, so the counters always agree with the statuses stored. Every URL is counted once, as either
+// processed or failed.
+func (r *Resolver) add(status ResolverStatus) {
+	if !r.enabled(status.Provider) {
+		Log.Debugf("Skipping %s, hosted on unselected provider %s\n", status.Url, status.Provider)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if status.Reason != "" {
+		r.UrlsFailed += 1
+	} else {
+		r.UrlsProcessed += 1
+		if status.Provider != NoProvider {
+			r.Endpoints += 1
+		}
+		if status.Takeover {
+			r.TakeoverPossible += 1
+		}
+	}
+	r.Buckets = append(r.Buckets, status)
+	if r.OnResolve != nil {
+		r.OnResolve(status)
+	}
+}
+
+// Resolve a set of URLs across a bounded number of goroutines, falling back on the resolver's concurrency
+// if none is given. Results are stored in the same order as the URLs were given, as if they were resolved serially.
+func (r *Resolver) ResolveAll(urls []string, concurrency int) {
+	r.ResolveAllContext(context.Background(), urls, concurrency)
+}
+
+// Resolve a set of URLs like `ResolveAll` until the context is cancelled, ie. on an interrupt. No new URLs are
+// started once cancelled, and this only returns after every URL in flight has finished, so results are complete
+// and safe to read.
+func (r *Resolver) ResolveAllContext(ctx context.Context, urls []string, concurrency int) {
+	if concurrency < 1 {
+		concurrency = r.Concurrency
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range queue {
+				Log.Infof("Attempting to resolve %s...\n", url)
+				if err := r.ResolveContext(ctx, url); err != nil && ctx.Err() == nil {
+					Log.Error(err)
+				}
+				if r.OnProgress != nil && ctx.Err() == nil {
+					r.OnProgress()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, url := range urls {
+		select {
+		case queue <- url:
+		case <-ctx.Done():
+			Log.Debug("Resolving cancelled, waiting on URLs in flight")
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	// restore ordering based on the input URLs
+	order := map[string]int{}
+	for i, url := range urls {
+		_, relativeUrl := GenerateUrlPair(url)
+		if _, ok := order[relativeUrl]; !ok {
+			order[relativeUrl] = i
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sort.SliceStable(r.Buckets, func(i, j int) bool {
+		return order[r.Buckets[i].Url] < order[r.Buckets[j].Url]
+	})
+}
+
+// Send a GET request to a URL, retrying over HTTPS if it was over HTTP and either failed or was redirected to
+// HTTPS, as many sites only respond over HTTPS. Returns the URL the response came from.
+func (r *Resolver) get(ctx context.Context, client *http.Client, fullUrl string) (*http.Response, string, error) {
+	Log.Debugf("Sending GET to %s\n", fullUrl)
+	resp, err := getContext(ctx, client, fullUrl)
+	if !strings.HasPrefix(fullUrl, "http://") {
+		return resp, fullUrl, err
+	}
+
+	if err == nil {
+		redirect := resp.StatusCode >= 300 && resp.StatusCode < 400
+		if !redirect || !strings.HasPrefix(resp.Header.Get("Location"), "https://") {
+			return resp, fullUrl, nil
+		}
+		resp.Body.Close()
+	}
+
+	secureUrl := "https://" + strings.TrimPrefix(fullUrl, "http://")
+	Log.Debugf("Retrying GET over HTTPS to %s\n", secureUrl)
+	secureResp, secureErr := getContext(ctx, client, secureUrl)
+	if secureErr != nil {
+		// report the original failure, as HTTPS may just not be supported
+		if err != nil {
+			return nil, fullUrl, err
+		}
+		return nil, fullUrl, secureErr
+	}
+	return secureResp, secureUrl, nil
+}
+
+// Helper that checks if a response is worth parsing for S3 metadata. Only 2xx or 4xx responses carrying S3
+// headers or XML are considered, along with 3xx responses carrying S3 headers, as S3 answers a request to the
+// wrong region with a `PermanentRedirect` error and no `Location`, which the client can't follow.
+func isS3Response(resp *http.Response) bool {
+	fromS3 := resp.Header.Get("Server") == "AmazonS3" || resp.Header.Get("x-amz-request-id") != "" ||
+		resp.Header.Get("x-amz-id-2") != ""
+
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		return fromS3
+	case resp.StatusCode >= 200 && resp.StatusCode < 300, resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return fromS3 || strings.Contains(resp.Header.Get("Content-Type"), "xml")
+	}
+	return false
+}
+
+// Helper that sends a GET request bound to a context.
+func getContext(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if UserAgent != "" {
+		req.Header.Set("User-Agent", UserAgent)
 	}
+	return client.Do(req)
 }
 
 // Given a single URL, run a set of actions against it in order to resolve a bucket name, while also
@@ -78,14 +514,14 @@ func NewResolver() *Resolver {
 // 3. Check if URL itself is a bucket name
 // 4. Parse data as XML and check tags for any S3 metadata
 func (r *Resolver) Resolve(url string) error {
-	log.Println("Sanity check if already an AWS URL")
-	if strings.Contains(url, "amazonaws.com") {
-		r.UrlsFailed += 1
-		return errors.New("Already a S3 URL, no need to resolve further.")
-	}
+	return r.ResolveContext(context.Background(), url)
+}
 
+// Resolve a single URL like `Resolve` until the context is cancelled. A URL interrupted before it responds
+// isn't counted as failed, and the context's error is returned instead.
+func (r *Resolver) ResolveContext(ctx context.Context, url string) error {
 	// get both a qualified URL and normal relative URL
-	log.Println("Creating relative and full URLs for HTTP and DNS.")
+	Log.Debug("Creating relative and full URLs for HTTP and DNS.")
 	fullUrl, relativeUrl := GenerateUrlPair(url)
 
 	// default status, nothing found
@@ -93,91 +529,114 @@ func (r *Resolver) Resolve(url string) error {
 		Url:      relativeUrl,
 		Bucket:   NoBucket,
 		Region:   NoRegion,
+		Provider: NoProvider,
 		Takeover: false,
 	}
 
-	// stop hanging on requests that time out
-	client := http.Client{
-		Timeout: 3 * time.Second,
+	Log.Debug("Sanity check if already an AWS URL")
+	if strings.Contains(url, "amazonaws.com") {
+		return r.fail(status, &ResolveError{
+			Url:   relativeUrl,
+			Check: "sanity check",
+			Kind:  ErrUnsupported,
+			Err:   errors.New("Already a S3 URL, no need to resolve further."),
+		})
 	}
 
+	// stop hanging on requests that time out, sending them through the proxy if one is set
+	client := NewHTTPClient(r.Timeout)
+
 	// GET request to url and parse out data
-	log.Printf("Sending GET to %s\n", fullUrl)
-	resp, err := client.Get(fullUrl)
-	if err != nil {
-		r.UrlsFailed += 1
-		return err
+	resp, fullUrl, err := r.get(ctx, client, fullUrl)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	} else if err != nil {
+		// a CNAME dangling to a deleted Azure storage account won't respond at all, but can be taken over
+		if cname, _ := r.cname(relativeUrl); strings.Contains(cname, ".blob.core.windows.net") && r.enabled(ProviderAzure) {
+			if _, lookupErr := r.lookupHost(cname); lookupErr != nil {
+				Log.Info("Azure storage account in CNAME doesn't resolve, takeover is possible")
+				r.resolveAzure(&status, cname, fullUrl, nil)
+				return nil
+			}
+		}
+		return r.fail(status, &ResolveError{
+			Url:   relativeUrl,
+			Check: "request",
+			Kind:  errorKind(err),
+			Err:   err,
+		})
 	}
 	defer resp.Body.Close()
 	bytedata, err := io.ReadAll(resp.Body)
 	if err != nil {
-		r.UrlsFailed += 1
-		return err
+		return r.fail(status, &ResolveError{
+			Url:   relativeUrl,
+			Check: "reading response",
+			Kind:  errorKind(err),
+			Err:   err,
+		})
 	}
 
-	// can successfully ping the endpoint
-	r.UrlsProcessed += 1
-
 	/////////////////////////////////
 	// FIRST CHECK: Request Headers
 	/////////////////////////////////
 
-	log.Println("Starting First Check: Request Headers")
+	Log.Debug("Starting First Check: Request Headers")
 
 	// skip if Google Cloud headers are present
 	if resp.Header.Get("X-GUploader-UploadID") != "" {
-		r.UrlsFailed += 1
-		return errors.New("Cannot deal with Google Cloud Storage yet.")
+		return r.fail(status, &ResolveError{
+			Url:   relativeUrl,
+			Check: "request headers",
+			Kind:  ErrUnsupported,
+			Err:   errors.New("Cannot deal with Google Cloud Storage yet."),
+		})
 	}
 
 	// check for `Server` header to be AmazonS3, but may be changed by proxy or CDN
 	server := resp.Header.Get("Server")
 	if server == "AmazonS3" {
 		status.Bucket = SomeBucket
-		log.Println("Detected AWS S3 bucket from URL")
+		Log.Debug("Detected AWS S3 bucket from URL")
 	}
 
 	// check if region is set in headers as well
 	region := resp.Header.Get("x-amz-bucket-region")
 	if region != "" {
 		status.Region = region
-		log.Println("Detected AWS S3 bucket region from URL")
+		Log.Debug("Detected AWS S3 bucket region from URL")
 	}
 
 	///////////////////////////////
 	// SECOND CHECK: CNAME Records
 	///////////////////////////////
 
-	log.Println("Starting Second Check: CNAME Records")
+	Log.Debug("Starting Second Check: CNAME Records")
 
 	// check if URL points to a S3 URL in any CNAME records. A bucket may use a CDN that
 	// masks the original S3 URL, so this may not return anything even if it is a bucket
-	potentialCname, _ := GetCNAME(relativeUrl)
-	if strings.Contains(potentialCname, ".amazonaws.com") {
+	potentialCname, _ := r.cname(relativeUrl)
 
-		log.Println("Found AWS URL in CNAME, parsing further")
+	// a wildcard record points every subdomain at the same target, so a match on it would be a false positive
+	if r.wildcard(relativeUrl, potentialCname) {
+		Log.Infof("Wildcard DNS detected for %s, ignoring its CNAME\n", relativeUrl)
+		status.WildcardDetected = true
+		goto bodyCheck
+	}
 
-		// s3-<REGION>.amazonaws.com/<BUCKET_NAME>/<OBJECTS>
-		expr1 := regexp.MustCompile(`s3-(?P<region>[^.]+).amazonaws.com/(?P<bucket>[^/]+)`)
-		expr1Matches := expr1.FindStringSubmatch(potentialCname)
-		if len(expr1Matches) != 0 {
-			status.Region = expr1Matches[1]
-			status.Bucket = expr1Matches[2]
-			log.Printf("Matched: s3-%s.amazonaws.com/%s\n", status.Region, status.Bucket)
-		}
+	if strings.Contains(potentialCname, ".amazonaws.com") {
+
+		Log.Debug("Found AWS URL in CNAME, parsing further")
 
-		// <BUCKET_NAME>.s3.<REGION>.amazonaws.com/<OBJECTS>
-		expr2 := regexp.MustCompile(`(?P<bucket>[^/]+).s3.(?P<region>[^.]+).amazonaws.com`)
-		expr2Matches := expr2.FindStringSubmatch(potentialCname)
-		if len(expr2Matches) != 0 {
-			status.Region = expr2Matches[2]
-			status.Bucket = expr2Matches[1]
-			log.Printf("Matched: %s.s3.%s.amazonaws.com\n", status.Bucket, status.Region)
+		if bucket, region, ok := ParseS3Url(potentialCname); ok {
+			status.Bucket = bucket
+			status.Region = region
+			Log.Debugf("Matched: bucket %s in %s\n", status.Bucket, status.Region)
 		}
 
 		// shouldn't happen, but continue checks if bucket name couldn't be found
 		if status.Bucket == NoBucket {
-			log.Println("Continuing checks, parsing CNAME didn't work out")
+			Log.Debug("Continuing checks, parsing CNAME didn't work out")
 			goto bodyCheck
 		}
 
@@ -187,16 +646,23 @@ func (r *Resolver) Resolve(url string) error {
 		}
 
 		// otherwise do a quick takeover check and return.
-		log.Println("Checking for takeover")
+		Log.Debug("Checking for takeover")
 		if strings.Contains(string(bytedata), "NoSuchBucket") {
-			r.TakeoverPossible += 1
 			status.Takeover = true
-			log.Println("Takeover is possible for parsed bucket")
+			status.Claimable = r.claimable(ctx, status.Bucket)
+			Log.Info("Takeover is possible for parsed bucket")
 		}
 
-		log.Println("Adding successful entry and returning")
-		r.Endpoints += 1
-		r.Buckets = append(r.Buckets, status)
+		Log.Debug("Adding successful entry and returning")
+		status.Provider = ProviderAWS
+		r.add(status)
+		return nil
+	}
+
+	// check if URL points to an Azure Blob Storage account in any CNAME records instead
+	if strings.Contains(potentialCname, ".blob.core.windows.net") && r.enabled(ProviderAzure) {
+		Log.Debug("Found Azure Blob Storage URL in CNAME, parsing further")
+		r.resolveAzure(&status, potentialCname, fullUrl, bytedata)
 		return nil
 	}
 
@@ -206,10 +672,13 @@ bodyCheck:
 	/// THIRD CHECK: URL AS BUCKET NAME
 	///////////////////////////////////
 
-	log.Println("Starting Third Check: URL as Bucket Name")
+	Log.Debug("Starting Third Check: URL as Bucket Name")
 
-	// status.Region being set helps make this faster, otherwise will enumerate through all regions
-	if val, region := CheckBucketExists(relativeUrl, status.Region); val {
+	// status.Region being set helps make this faster, otherwise will enumerate through all regions. Hosts
+	// that can't be bucket names, ie. IP addresses, are skipped rather than spending calls on them.
+	if !IsValidBucketName(relativeUrl) {
+		Log.Debugf("Skipping %s, not a valid bucket name\n", relativeUrl)
+	} else if val, region, _ := r.exists(ctx, relativeUrl, status.Region); val {
 		status.Bucket = relativeUrl
 		status.Region = region
 	}
@@ -218,83 +687,226 @@ bodyCheck:
 	/// FINAL CHECK: HTTP XML RESPONSE
 	///////////////////////////////////
 
-	// attempt to serialize into proper XML, if not, return
+	// only parse responses that came from S3, so error pages from unrelated sites aren't mistaken for buckets
 	xml := etree.NewDocument()
+	if !isS3Response(resp) {
+		Log.Debugf("Skipping body parsing for %d response that doesn't look like S3\n", resp.StatusCode)
+		goto end
+	}
+
+	// attempt to serialize into proper XML, if not, return
 	if err := xml.ReadFromBytes(bytedata); err != nil {
 		goto end
 	}
 
 	// TODO: Check for GCloud error
 
-	// if `Error` root is present, encountered a S3 error page
+	// if `Error` root is present, encountered a S3 error page. Some proxies and non-AWS error pages return
+	// documents missing tags we expect, so every tag is checked before being used.
 	if errTag := xml.FindElement("Error"); errTag != nil {
 
-		log.Println("Starting Final Check: Parsing XML Error")
+		Log.Debug("Starting Final Check: Parsing XML Error")
 
-		// get string for Code tag used to indicate error
-		code := errTag.SelectElement("Code").Text()
+		// get string for Code tag used to indicate error, not a S3 error page if missing
+		code := elementText(errTag, "Code")
+		bucketName := elementText(errTag, "BucketName")
+		if bucketName == "" {
+			bucketName = SomeBucket
+		}
 
-		// NoSuchBucket: bucket deleted, but takeover is possible!
-		if code == "NoSuchBucket" {
-			status.Bucket = errTag.SelectElement("BucketName").Text()
+		// NoSuchBucket: bucket deleted, but takeover is possible! Not trusted behind wildcard DNS, since any
+		// subdomain would report its own name as missing.
+		if code == "NoSuchBucket" && status.WildcardDetected {
+			Log.Debug("Ignoring NoSuchBucket behind wildcard DNS")
+		} else if code == "NoSuchBucket" {
+			status.Bucket = bucketName
 			status.Takeover = true
-			r.TakeoverPossible += 1
+			status.Claimable = r.claimable(ctx, status.Bucket)
 
-			// PermanentRedirect: wrong region, shouldn't be reached
+			// PermanentRedirect: bucket lives in a different region than the endpoint we hit
 		} else if code == "PermanentRedirect" {
-			status.Bucket = errTag.SelectElement("BucketName").Text()
+			status.Bucket = bucketName
+
+			// parse out region from the endpoint we're redirected to, ie. <BUCKET_NAME>.s3.<REGION>.amazonaws.com
+			if endpoint := elementText(errTag, "Endpoint"); endpoint != "" && bucketName != SomeBucket {
+				Log.Debugf("Redirected to %s, parsing region\n", endpoint)
+
+				region := "us-east-1"
+				if _, endpointRegion, ok := ParseS3Url(endpoint); ok {
+					region = endpointRegion
+				}
+
+				// confirm bucket exists against the region we were redirected to
+				if val, region, _ := r.exists(ctx, status.Bucket, region); val {
+					status.Region = region
+				}
+			}
 
 			// AccessDenied | NoSuchKey | etc: bucket exists, can't parse name
-		} else {
+		} else if code != "" {
 			status.Bucket = SomeBucket
 		}
 	}
 
 	// if `ListBucketResult` is present, encountered an open bucket
 	if resTag := xml.FindElement("ListBucketResult"); resTag != nil {
-		log.Println("Starting Final Check: Parsing Open Bucket")
-		status.Bucket = resTag.SelectElement("Name").Text()
+		Log.Debug("Starting Final Check: Parsing Open Bucket")
+		status.Bucket = SomeBucket
+		if name := elementText(resTag, "Name"); name != "" {
+			status.Bucket = name
+		}
 	}
 
 end:
 
-	// if name isn't unknown increment endpoint
+	// if name isn't unknown it's an endpoint
 	if status.Bucket != NoBucket {
-		r.Endpoints += 1
+		status.Provider = ProviderAWS
 	}
 
-	r.Buckets = append(r.Buckets, status)
+	r.add(status)
 	return nil
 }
 
-// Helper that takes a URL in any format and generates a FQDN and a relative URL
-func GenerateUrlPair(url string) (string, string) {
-	var fullUrl, relativeUrl string
+// Parse out the storage account and container from an Azure Blob Storage CNAME, and check for takeover, ie.
+// when the account no longer resolves, or the container no longer exists. Body is nil if the URL didn't respond.
+func (r *Resolver) resolveAzure(status *ResolverStatus, cname string, fullUrl string, body []byte) {
+	status.Provider = ProviderAzure
 
-	// if input is relative, construct full and save both
-	if !strings.Contains(url, "http") {
-		fullUrl = "http://" + url
-		relativeUrl = url
+	// <ACCOUNT>.blob.core.windows.net/<CONTAINER>/<BLOBS>
+	expr := regexp.MustCompile(`(?P<account>[a-z0-9]+)\.blob\.core\.windows\.net`)
+	if matches := expr.FindStringSubmatch(cname); len(matches) != 0 {
+		status.Bucket = matches[1]
 
-		// other way around
-	} else {
-		fullUrl = url
+		// container is the first path segment of the URL, if any
+		trimmed := strings.TrimPrefix(strings.TrimPrefix(fullUrl, "http://"), "https://")
+		path := strings.SplitN(trimmed, "/", 3)
+		if len(path) > 1 && path[1] != "" {
+			status.Bucket = matches[1] + "/" + path[1]
+		}
+		Log.Debugf("Matched: %s.blob.core.windows.net\n", matches[1])
+	}
+
+	// account doesn't resolve, or the container is missing
+	content := string(body)
+	if body == nil || strings.Contains(content, "ContainerNotFound") ||
+		strings.Contains(content, "The specified container does not exist") {
+		status.Takeover = true
+		Log.Info("Takeover is possible for parsed storage account")
+	}
+
+	r.add(*status)
+}
+
+// Helper that gets the text of a child element, or an empty string if the element is missing.
+func elementText(parent *etree.Element, tag string) string {
+	if el := parent.SelectElement(tag); el != nil {
+		return strings.TrimSpace(el.Text())
+	}
+	return ""
+}
+
+var (
+	// <BUCKET_NAME>.s3-accesspoint[.dualstack].<REGION>.amazonaws.com
+	accessPointExpr = regexp.MustCompile(`^(?P<bucket>.+)\.s3-accesspoint(?:\.dualstack)?\.(?P<region>[a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+	// <BUCKET_NAME>.s3-website[.-]<REGION>.amazonaws.com
+	websiteExpr = regexp.MustCompile(`^(?P<bucket>.+)\.s3-website[.-](?P<region>[a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+	// <BUCKET_NAME>.s3[.dualstack][.-]<REGION>.amazonaws.com
+	virtualRegionExpr = regexp.MustCompile(`^(?P<bucket>.+)\.s3(?:\.dualstack)?[.-](?P<region>[a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+	// <BUCKET_NAME>.s3.amazonaws.com
+	virtualExpr = regexp.MustCompile(`^(?P<bucket>.+)\.s3\.amazonaws\.com$`)
+
+	// s3[.dualstack][.-]<REGION>.amazonaws.com/<BUCKET_NAME>
+	pathRegionExpr = regexp.MustCompile(`^s3(?:\.dualstack)?[.-](?P<region>[a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+	// s3.amazonaws.com/<BUCKET_NAME>
+	pathExpr = regexp.MustCompile(`^s3\.amazonaws\.com$`)
+)
+
+// Parse out a bucket name and region from any of the S3 hostname formats, which may also include a path for
+// path-style URLs. Legacy global endpoints without a region resolve to `us-east-1`.
+func ParseS3Url(host string) (string, string, bool) {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "http://"), "https://")
+	host = strings.ToLower(host)
+
+	// split off path, where the first segment is the bucket name for path-style URLs
+	path := ""
+	if idx := strings.Index(host, "/"); idx != -1 {
+		path = strings.Split(host[idx+1:], "/")[0]
+		host = host[:idx]
+	}
+	host = strings.TrimSuffix(host, ".")
 
-		// remove prepended protocol
-		if strings.Contains(url, "http://") {
-			relativeUrl = strings.TrimPrefix(url, "http://")
-		} else if strings.Contains(url, "https://") {
-			relativeUrl = strings.TrimPrefix(url, "https://")
+	normalize := func(region string) string {
+		if region == "external-1" {
+			return "us-east-1"
 		}
-		relativeUrl = strings.TrimSuffix(relativeUrl, "/")
+		return region
 	}
-	return fullUrl, relativeUrl
+
+	// virtual-hosted style, where bucket name is part of the hostname
+	for _, expr := range []*regexp.Regexp{accessPointExpr, websiteExpr, virtualRegionExpr} {
+		if matches := expr.FindStringSubmatch(host); len(matches) != 0 {
+			return matches[1], normalize(matches[2]), true
+		}
+	}
+	if matches := virtualExpr.FindStringSubmatch(host); len(matches) != 0 {
+		return matches[1], "us-east-1", true
+	}
+
+	// path-style, where bucket name is the first segment of the path
+	if path == "" {
+		return "", "", false
+	}
+	if matches := pathRegionExpr.FindStringSubmatch(host); len(matches) != 0 {
+		return path, normalize(matches[1]), true
+	}
+	if pathExpr.MatchString(host) {
+		return path, "us-east-1", true
+	}
+	return "", "", false
+}
+
+// Helper that takes a URL in any format and generates a FQDN and a relative URL. The FQDN keeps any path and
+// query string to send requests to, while the relative URL is only the hostname without a port, used for DNS
+// lookups and as a potential bucket name.
+func GenerateUrlPair(rawUrl string) (string, string) {
+	rawUrl = strings.TrimSpace(rawUrl)
+
+	// if input is relative, construct full
+	fullUrl := rawUrl
+	if !strings.HasPrefix(rawUrl, "http://") && !strings.HasPrefix(rawUrl, "https://") {
+		fullUrl = "http://" + rawUrl
+	}
+
+	// keep only the hostname, falling back on stripping the protocol and path by hand if it can't be parsed
+	parsed, err := url.Parse(fullUrl)
+	if err != nil || parsed.Hostname() == "" {
+		relativeUrl := strings.TrimPrefix(strings.TrimPrefix(fullUrl, "http://"), "https://")
+		relativeUrl = strings.SplitN(relativeUrl, "/", 2)[0]
+		relativeUrl = strings.SplitN(relativeUrl, "?", 2)[0]
+		return fullUrl, relativeUrl
+	}
+	return fullUrl, strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
 }
 
 // Traverse a CNAME chain to the end and return the resultant URL
 func GetCNAME(url string) (string, error) {
+	return LookupCNAME(context.Background(), nil, url)
+}
+
+// Traverse a CNAME chain to the end with a specific DNS resolver, or the system one if nil, until the
+// context is done.
+func LookupCNAME(ctx context.Context, dns *net.Resolver, url string) (string, error) {
+	if dns == nil {
+		dns = net.DefaultResolver
+	}
+
 	// do lookup
-	cname, err := net.LookupCNAME(url)
+	cname, err := dns.LookupCNAME(ctx, url)
 	if err != nil {
 		return "", errors.New("Domain name doesn't exist")
 	}
@@ -308,48 +920,152 @@ func GetCNAME(url string) (string, error) {
 	return cname, nil
 }
 
+// Copy the statuses stored so far, which are safe to read while URLs are still being resolved.
+func (r *Resolver) Snapshot() []ResolverStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ResolverStatus{}, r.Buckets...)
+}
+
 func (r *Resolver) Table() [][]string {
 	var contents [][]string
-	for _, status := range r.Buckets {
-		if status.Bucket != NoBucket {
-			contents = append(contents, status.Row())
+	seen := map[string]bool{}
+	for _, status := range r.Snapshot() {
+		if r.OnlyTakeover && !status.Takeover {
+			continue
+		}
+		if r.Dedupe && status.Bucket != SomeBucket && status.Bucket != NoBucket && status.Reason == "" {
+			if seen[status.Bucket] {
+				continue
+			}
+			seen[status.Bucket] = true
+		}
+		if status.Reason != "" {
+			if r.ShowFailures {
+				contents = append(contents, append(status.Row(), status.Reason))
+			}
+		} else if status.Bucket != NoBucket {
+			row := status.Row()
+			if r.ShowFailures {
+				row = append(row, "")
+			}
+			contents = append(contents, row)
 		}
 	}
 	return contents
 }
 
-// Finalize by writing bucket names to a filepath, and displaying stats to user.
-func (r *Resolver) OutputStats(path string) error {
-	// if path is specified write bucket names to path
-	if path != "" {
-		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
+// Get the first status for every bucket that can be taken over and was confirmed to be unclaimed, ie. to
+// demonstrate the takeover by claiming it.
+func (r *Resolver) Claimable() []ResolverStatus {
+	claimable := []ResolverStatus{}
+	seen := map[string]bool{}
+	for _, status := range r.Snapshot() {
+		if status.Takeover && status.Claimable && status.Provider == ProviderAWS && !seen[status.Bucket] {
+			seen[status.Bucket] = true
+			claimable = append(claimable, status)
 		}
-		defer file.Close()
+	}
+	return claimable
+}
 
-		// write each entry as a line, ignore takeovers since they don't exist
-		writer := bufio.NewWriter(file)
-		for _, data := range r.Buckets {
-			if !data.Takeover && data.Bucket != SomeBucket {
-				_, _ = writer.WriteString(data.Bucket + "\n")
-			}
+// Write bucket names resolved to a filepath, ignoring takeovers since they don't exist. If only takeovers are
+// wanted, then the names of the buckets that can be taken over are written instead.
+func (r *Resolver) OutputBuckets(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// write each unique entry as a line
+	writer := bufio.NewWriter(file)
+	seen := map[string]bool{}
+	for _, data := range r.Snapshot() {
+		if data.Takeover == r.OnlyTakeover && data.Bucket != SomeBucket && data.Bucket != NoBucket && !seen[data.Bucket] {
+			seen[data.Bucket] = true
+			_, _ = writer.WriteString(data.Bucket + "\n")
 		}
-		writer.Flush()
 	}
+	return writer.Flush()
+}
+
+// Counters for the URLs resolved so far
+type ResolverSummary struct {
+	// URLs successfully processed
+	Processed int `json:"processed"`
+
+	// URLs that failed to process
+	Failed int `json:"failed"`
+
+	// S3 endpoints identified, even if the name couldn't be found
+	Endpoints int `json:"endpoints"`
 
-	var nameCount int
+	// distinct bucket names identified, since several URLs may front the same bucket
+	UniqueBucketNames int `json:"unique_bucket_names"`
+
+	// endpoints that can be taken over
+	Takeovers int `json:"takeovers"`
+}
+
+// Summarize the URLs resolved so far, ie. for consuming results without parsing displayed stats.
+func (r *Resolver) Summary() ResolverSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// several URLs may front the same bucket, so only count unique names
+	names := map[string]bool{}
 	for _, data := range r.Buckets {
-		if data.Bucket != SomeBucket {
-			nameCount += 1
+		if data.Bucket != SomeBucket && data.Bucket != NoBucket {
+			names[data.Bucket] = true
+		}
+	}
+
+	return ResolverSummary{
+		Processed:         r.UrlsProcessed,
+		Failed:            r.UrlsFailed,
+		Endpoints:         r.Endpoints,
+		UniqueBucketNames: len(names),
+		Takeovers:         r.TakeoverPossible,
+	}
+}
+
+// Finalize by writing bucket names to a filepath, and writing stats for the user.
+func (r *Resolver) OutputStats(w io.Writer, path string) error {
+	// if path is specified write bucket names to path
+	if path != "" {
+		if err := r.OutputBuckets(path); err != nil {
+			return err
 		}
 	}
 
 	// output rest of the stats
-	fmt.Printf("\nURLs Processed: %d\n", r.UrlsProcessed)
-	fmt.Printf("URLs Failed: %d\n\n", r.UrlsFailed)
-	fmt.Printf("S3 Endpoints Found: %d\n", r.Endpoints)
-	fmt.Printf("Bucket Names Identified: %d\n", nameCount)
-	fmt.Printf("Bucket Takeovers Possible: %d\n\n", r.TakeoverPossible)
+	summary := r.Summary()
+	fmt.Fprintf(w, "\nURLs Processed: %d\n", summary.Processed)
+	fmt.Fprintf(w, "URLs Failed: %d\n\n", summary.Failed)
+	fmt.Fprintf(w, "S3 Endpoints Found: %d\n", summary.Endpoints)
+	fmt.Fprintf(w, "Bucket Names Identified: %d\n", summary.UniqueBucketNames)
+	fmt.Fprintf(w, "Bucket Takeovers Possible: %d\n\n", summary.Takeovers)
 	return nil
 }
+
+// Write every processed entry, including those that didn't resolve to a bucket, as a CSV to a filepath.
+func (r *Resolver) OutputCSV(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"URL", "Bucket", "Region", "Provider", "Takeover", "Claimable", "Reason"}); err != nil {
+		return err
+	}
+	for _, status := range r.Snapshot() {
+		if err := writer.Write(append(status.Row(), status.Reason)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
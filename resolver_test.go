@@ -0,0 +1,258 @@
+package slamdunk
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// S3 answers a request to the wrong region with a 301 that has no `Location`, so the client returns it as is
+// and the `PermanentRedirect` error in its body must still be parsed.
+func TestResolvePermanentRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("x-amz-request-id", "0123456789ABCDEF")
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusMovedPermanently)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>PermanentRedirect</Code><Message>The bucket you are attempting to access must be addressed using the specified endpoint.</Message><BucketName>redirected-bucket</BucketName></Error>`))
+	}))
+	defer server.Close()
+
+	resolver := NewResolver()
+	if err := resolver.Resolve(server.URL); err != nil {
+		t.Fatalf("Resolve(%s) failed: %s", server.URL, err)
+	}
+	if len(resolver.Buckets) != 1 {
+		t.Fatalf("got %d statuses, want 1", len(resolver.Buckets))
+	}
+	if status := resolver.Buckets[0]; status.Bucket != "redirected-bucket" || status.Provider != ProviderAWS {
+		t.Errorf("got bucket %q from %q, want redirected-bucket from %q", status.Bucket, status.Provider, ProviderAWS)
+	}
+}
+
+func TestIsS3Response(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		want    bool
+	}{
+		{"open bucket", http.StatusOK, map[string]string{"Server": "AmazonS3"}, true},
+		{"denied bucket", http.StatusForbidden, map[string]string{"x-amz-request-id": "ABC"}, true},
+		{"xml error page", http.StatusNotFound, map[string]string{"Content-Type": "application/xml"}, true},
+		{"permanent redirect", http.StatusMovedPermanently, map[string]string{"x-amz-id-2": "ABC"}, true},
+		{"unrelated redirect", http.StatusFound, map[string]string{"Content-Type": "text/xml"}, false},
+		{"unrelated page", http.StatusNotFound, map[string]string{"Content-Type": "text/html"}, false},
+		{"server error", http.StatusInternalServerError, map[string]string{"Server": "AmazonS3"}, false},
+	}
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: test.status, Header: http.Header{}}
+		for key, value := range test.headers {
+			resp.Header.Set(key, value)
+		}
+		if got := isS3Response(resp); got != test.want {
+			t.Errorf("%s: isS3Response() = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseS3Url(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		bucket string
+		region string
+		ok     bool
+	}{
+		{"virtual", "assets.s3.amazonaws.com", "assets", "us-east-1", true},
+		{"virtual with region", "assets.s3.eu-west-1.amazonaws.com", "assets", "eu-west-1", true},
+		{"dash region", "assets.s3-us-west-2.amazonaws.com", "assets", "us-west-2", true},
+		{"dualstack", "assets.s3.dualstack.ap-south-1.amazonaws.com", "assets", "ap-south-1", true},
+		{"website", "www.example.com.s3-website-us-east-1.amazonaws.com", "www.example.com", "us-east-1", true},
+		{"website dot region", "site.s3-website.eu-central-1.amazonaws.com", "site", "eu-central-1", true},
+		{"accesspoint", "reports-111122223333.s3-accesspoint.us-west-2.amazonaws.com", "reports-111122223333", "us-west-2", true},
+		{"path with region", "https://s3.eu-central-1.amazonaws.com/assets/css/site.css", "assets", "eu-central-1", true},
+		{"legacy path", "s3.amazonaws.com/assets", "assets", "us-east-1", true},
+		{"external-1", "assets.s3-external-1.amazonaws.com", "assets", "us-east-1", true},
+		{"china", "assets.s3.cn-north-1.amazonaws.com.cn", "assets", "cn-north-1", true},
+		{"trailing dot", "assets.s3.amazonaws.com.", "assets", "us-east-1", true},
+		{"path without bucket", "s3.amazonaws.com", "", "", false},
+		{"no match", "www.example.com", "", "", false},
+	}
+	for _, test := range tests {
+		bucket, region, ok := ParseS3Url(test.host)
+		if bucket != test.bucket || region != test.region || ok != test.ok {
+			t.Errorf("%s: ParseS3Url(%q) = (%q, %q, %t), want (%q, %q, %t)", test.name, test.host,
+				bucket, region, ok, test.bucket, test.region, test.ok)
+		}
+	}
+}
+
+// Resolve a URL serving a body as an S3 XML response, returning the status recorded for it.
+func resolveBody(t *testing.T, code int, body string) ResolverStatus {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	resolver := NewResolver()
+	if err := resolver.Resolve(server.URL); err != nil {
+		t.Fatalf("Resolve(%s) failed: %s", server.URL, err)
+	}
+	if len(resolver.Buckets) != 1 {
+		t.Fatalf("got %d statuses, want 1", len(resolver.Buckets))
+	}
+	return resolver.Buckets[0]
+}
+
+func TestResolveMalformedXML(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		body     string
+		bucket   string
+		takeover bool
+	}{
+		{"error without code or bucket", http.StatusForbidden, `<Error><Message>Denied</Message></Error>`, NoBucket, false},
+		{"error without bucket", http.StatusForbidden, `<Error><Code>AccessDenied</Code></Error>`, SomeBucket, false},
+		{"missing bucket without name", http.StatusNotFound, `<Error><Code>NoSuchBucket</Code></Error>`, SomeBucket, true},
+		{"listing without name", http.StatusOK, `<ListBucketResult><Contents><Key>a.txt</Key></Contents></ListBucketResult>`, SomeBucket, false},
+		{"listing with empty name", http.StatusOK, `<ListBucketResult><Name> </Name></ListBucketResult>`, SomeBucket, false},
+		{"listing with name", http.StatusOK, `<ListBucketResult><Name>open-bucket</Name></ListBucketResult>`, "open-bucket", false},
+		{"not xml", http.StatusOK, `<html><body>Not a bucket`, NoBucket, false},
+	}
+	for _, test := range tests {
+		status := resolveBody(t, test.code, test.body)
+		if status.Bucket != test.bucket || status.Takeover != test.takeover {
+			t.Errorf("%s: got bucket %q with takeover %t, want %q with takeover %t", test.name,
+				status.Bucket, status.Takeover, test.bucket, test.takeover)
+		}
+	}
+}
+
+// Every URL must be counted exactly once, as either processed or failed, however it responds.
+func TestResolveAllCounts(t *testing.T) {
+	serve := func(code int, headers map[string]string, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			for key, value := range headers {
+				w.Header().Set(key, value)
+			}
+			w.WriteHeader(code)
+			w.Write([]byte(body))
+		}))
+	}
+
+	servers := []*httptest.Server{
+		serve(http.StatusOK, map[string]string{"Content-Type": "text/html"}, "<html></html>"),
+		serve(http.StatusForbidden, map[string]string{"Server": "AmazonS3"}, ""),
+		serve(http.StatusForbidden, map[string]string{"Content-Type": "application/xml"},
+			`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`),
+		serve(http.StatusOK, map[string]string{"X-GUploader-UploadID": "ABC"}, ""),
+	}
+	urls := []string{}
+	for _, server := range servers {
+		defer server.Close()
+		urls = append(urls, server.URL)
+	}
+
+	// nothing listens once the server is closed, so the connection is refused
+	closed := serve(http.StatusOK, nil, "")
+	closed.Close()
+	urls = append(urls, closed.URL)
+
+	resolver := NewResolver(WithConcurrency(2))
+	resolver.ResolveAll(urls, 0)
+
+	if total := resolver.UrlsProcessed + resolver.UrlsFailed; total != len(urls) {
+		t.Errorf("processed %d and failed %d, want them to add up to %d", resolver.UrlsProcessed, resolver.UrlsFailed, len(urls))
+	}
+	if resolver.UrlsFailed != 2 {
+		t.Errorf("failed %d, want 2 for the Google Cloud response and closed port", resolver.UrlsFailed)
+	}
+}
+
+// Failed URLs all share the same sentinel bucket, so deduplicating must not collapse them into one row.
+func TestTableDedupeFailures(t *testing.T) {
+	urls := []string{}
+	for i := 0; i < 2; i++ {
+		closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+		closed.Close()
+		urls = append(urls, closed.URL)
+	}
+
+	resolver := NewResolver()
+	resolver.Dedupe = true
+	resolver.ShowFailures = true
+	resolver.ResolveAll(urls, 0)
+
+	rows := resolver.Table()
+	if len(rows) != len(urls) {
+		t.Fatalf("got %d rows, want one for each of the %d failed URLs: %v", len(rows), len(urls), rows)
+	}
+	for _, row := range rows {
+		if row[len(row)-1] == "" {
+			t.Errorf("failed URL rendered without a reason: %v", row)
+		}
+	}
+}
+
+// The reason recorded for a failed URL is the same kind of failure that the returned error matches.
+func TestResolveFailureReason(t *testing.T) {
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	closed.Close()
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-GUploader-UploadID", "ABC")
+	}))
+	defer google.Close()
+
+	tests := []struct {
+		url  string
+		kind error
+	}{
+		{closed.URL, ErrConnection},
+		{google.URL, ErrUnsupported},
+		{"https://assets.s3.amazonaws.com", ErrUnsupported},
+	}
+	for _, test := range tests {
+		resolver := NewResolver()
+		err := resolver.Resolve(test.url)
+		if !errors.Is(err, test.kind) {
+			t.Errorf("Resolve(%s) = %v, want a %q failure", test.url, err, test.kind)
+		}
+		if len(resolver.Buckets) != 1 || resolver.Buckets[0].Reason != test.kind.Error() {
+			t.Errorf("Resolve(%s) recorded %v, want reason %q", test.url, resolver.Buckets, test.kind)
+		}
+	}
+}
+
+// URLs resolved to providers that weren't selected must not be counted, so the summary agrees with the table.
+func TestResolveProviderFilterCounts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<Error><Code>NoSuchBucket</Code></Error>`))
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(WithProviders(ProviderAzure))
+	if err := resolver.Resolve(server.URL); err != nil {
+		t.Fatalf("Resolve(%s) failed: %s", server.URL, err)
+	}
+	if len(resolver.Buckets) != 0 {
+		t.Errorf("got %d statuses, want none for an unselected provider", len(resolver.Buckets))
+	}
+	summary := resolver.Summary()
+	if summary.Processed != 0 || summary.Endpoints != 0 || summary.Takeovers != 0 {
+		t.Errorf("got summary %+v, want nothing counted for an unselected provider", summary)
+	}
+
+	resolver = NewResolver(WithProviders(ProviderAWS))
+	resolver.Resolve(server.URL)
+	summary = resolver.Summary()
+	if summary.Processed != 1 || summary.Endpoints != 1 || summary.Takeovers != 1 {
+		t.Errorf("got summary %+v, want the takeover counted for a selected provider", summary)
+	}
+}
@@ -1,52 +1,359 @@
 package slamdunk
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/sts"
-	"log"
-	"os"
-	"os/user"
+	"golang.org/x/time/rate"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 )
 
-// Determine the bucket region using a default regionHint of `us-east-1`
-func GetRegion(bucket string) (string, error) {
-	sess := session.Must(session.NewSession())
-	region, err := s3manager.GetBucketRegion(aws.BackgroundContext(), sess, bucket, "us-east-1")
+var (
+	// maximum number of times throttled requests (ie. `SlowDown`) are retried with exponential backoff
+	MaxRetries = 3
+
+	// limits the rate of requests sent across every session, shared so that changing the rate also applies
+	// to sessions that were already created
+	limiter = rate.NewLimiter(rate.Inf, 1)
+
+	// if set, sessions use dualstack endpoints that can be reached over IPv6, ie. `s3.dualstack.<REGION>.amazonaws.com`
+	DualStack bool
+
+	// region sessions are created in when a bucket's region isn't known yet, ie. for discovering regions and
+	// listing buckets. Should be changed when working in another partition, ie. `cn-north-1`.
+	DefaultRegion = GlobalRegion
+
+	// sends every request made by sessions, the resolver and website checks, replaced when a proxy is set
+	// or TLS verification is skipped
+	transport = http.DefaultTransport
+
+	// if set, sent as the user agent of every request instead of the SDK's and Go's defaults
+	UserAgent string
+
+	// proxy requests are sent through, if any
+	proxyUrl *url.URL
+
+	// if set, TLS certificates aren't verified, ie. for self-hosted stores with self-signed certificates
+	insecure bool
+)
+
+// Limit the number of requests sent per second across every session, where zero removes the limit.
+func SetRateLimit(rps int) {
+	if rps > 0 {
+		limiter.SetLimit(rate.Limit(rps))
+	} else {
+		limiter.SetLimit(rate.Inf)
+	}
+}
+
+// Route every request through an HTTP or SOCKS5 proxy, ie. `socks5://127.0.0.1:1080`, where empty removes it.
+func SetProxy(proxy string) error {
+	if proxy == "" {
+		proxyUrl = nil
+		configureTransport()
+		return nil
+	}
+
+	parsed, err := url.Parse(proxy)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("Invalid proxy %s, must be a URL like http://host:port or socks5://host:port.", proxy)
+	}
+	proxyUrl = parsed
+	configureTransport()
+	return nil
+}
+
+// Skip verifying TLS certificates for every request, ie. for self-hosted S3-compatible stores with self-signed
+// certificates. Responses can then be forged by anyone intercepting traffic, so only set this explicitly.
+func SetInsecure(skip bool) {
+	insecure = skip
+	configureTransport()
+}
+
+// Helper that rebuilds the shared transport from the proxy and TLS settings, using the default one if neither is set.
+func configureTransport() {
+	if proxyUrl == nil && !insecure {
+		transport = http.DefaultTransport
+		return
+	}
+
+	custom := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyUrl != nil {
+		custom.Proxy = http.ProxyURL(proxyUrl)
+	}
+	if insecure {
+		custom.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	transport = custom
+}
+
+// Create an HTTP client that sends requests through the proxy, if one is set, giving up after a timeout
+// unless it is zero.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
+// Base configuration for every session, setting up retries, dualstack endpoints, the proxy and an optional region.
+func baseConfig(region string) *aws.Config {
+	config := &aws.Config{
+		MaxRetries:   aws.Int(MaxRetries),
+		UseDualStack: aws.Bool(DualStack),
+		HTTPClient:   NewHTTPClient(0),
+	}
+	if region != "" {
+		config.Region = aws.String(region)
+
+		// resolve endpoints within the region's partition, ie. `amazonaws.com.cn` for China
+		if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+			config.EndpointResolver = partition
+		}
+	}
+	return config
+}
+
+// Helper that checks if a region is in a partition isolated from the standard one, ie. China or GovCloud,
+// which can't be reached with standard credentials and report `Forbidden` for every bucket.
+func IsIsolatedRegion(region string) bool {
+	partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+	if !ok {
+		return false
+	}
+	id := partition.ID()
+	return id == endpoints.AwsCnPartitionID || id == endpoints.AwsUsGovPartitionID
+}
+
+// Helper that makes a session wait on the rate limit before sending each request, giving up if the request's
+// context is cancelled first, and replace the SDK's user agent with the configured one, if any. The wait is done
+// last when signing, as an error there stops the attempt before anything is sent.
+func withHandlers(sess *session.Session) *session.Session {
+	sess.Handlers.Sign.PushBack(func(r *request.Request) {
+		if err := limiter.Wait(r.Context()); err != nil {
+			r.Error = awserr.New(request.CanceledErrorCode, "request context canceled", err)
+		}
+	})
+	if UserAgent != "" {
+		agent := UserAgent
+		sess.Handlers.Build.PushBack(func(r *request.Request) {
+			r.HTTPRequest.Header.Set("User-Agent", agent)
+		})
+	}
+	return sess
+}
+
+// Configures how every authenticated AWS session is created during a run.
+type SessionConfig struct {
+	// name of the IAM profile to use
+	Profile string
+
+	// if set, role assumed using the profile's credentials, ie. for cross-account audits
+	RoleArn string
+
+	// optional external ID required by the assumed role's trust policy
+	ExternalId string
+
+	// if set, requests are sent without credentials, as an unauthenticated user would
+	Anonymous bool
+
+	// if set, shared credentials and config files read instead of the ones in `~/.aws`, ie. when mounted elsewhere
+	CredentialsFile string
+	ConfigFile      string
+}
+
+// Helper that gets the shared files to load profiles from, or nil to use the SDK's defaults. If only one of the
+// files is overridden, the default location is still used for the other.
+func (c *SessionConfig) sharedConfigFiles() []string {
+	if c.CredentialsFile == "" && c.ConfigFile == "" {
+		return nil
+	}
+	credentialsFile := c.CredentialsFile
+	if credentialsFile == "" {
+		credentialsFile = defaults.SharedCredentialsFilename()
+	}
+	configFile := c.ConfigFile
+	if configFile == "" {
+		configFile = defaults.SharedConfigFilename()
+	}
+	return []string{credentialsFile, configFile}
+}
+
+// Create a new session for a region. Credentials are resolved with the following precedence:
+//
+// 1. If the profile is empty or `default`, no profile is forced onto the session, letting the SDK's default
+//    credential chain resolve it: environment variables (ie. `AWS_ACCESS_KEY_ID`, `AWS_SESSION_TOKEN`),
+//    then `AWS_PROFILE`, then the default shared profile, and finally any container or EC2 instance role.
+// 2. Otherwise the named profile is looked up from the shared credentials and config files.
+//
+// If a role ARN is set, the credentials resolved above are then used to assume it. If anonymous, none of the
+// above applies and requests are sent unsigned.
+func (c *SessionConfig) NewSession(region string) (*session.Session, error) {
+	if c.Anonymous {
+		config := baseConfig(region)
+		config.Credentials = credentials.AnonymousCredentials
+		sess, err := session.NewSession(config)
+		if err != nil {
+			return nil, err
+		}
+		return withHandlers(sess), nil
+	}
+
+	profile := c.Profile
+	if profile == "default" {
+		profile = ""
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Profile:           profile,
+		Config:            *baseConfig(region),
+		SharedConfigState: session.SharedConfigEnable,
+		SharedConfigFiles: c.sharedConfigFiles(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.RoleArn == "" {
+		return withHandlers(sess), nil
+	}
+
+	Log.Info("Assuming role", c.RoleArn)
+	creds := stscreds.NewCredentials(sess, c.RoleArn, func(p *stscreds.AssumeRoleProvider) {
+		if c.ExternalId != "" {
+			p.ExternalID = aws.String(c.ExternalId)
+		}
+	})
+	return withHandlers(sess.Copy(&aws.Config{Credentials: creds})), nil
+}
+
+// Helper that creates a session used to check if buckets exist, with credentials from the configuration if
+// set, and otherwise from the SDK's default credential chain.
+func checkSession(config *SessionConfig, region string) (*session.Session, error) {
+	if config != nil {
+		return config.NewSession(region)
+	}
+	sess, err := session.NewSession(baseConfig(region))
+	if err != nil {
+		return nil, err
+	}
+	return withHandlers(sess), nil
+}
+
+// Determine the bucket region, first with `GetBucketLocation`, which is cheaper and more reliable if allowed,
+// and otherwise falling back on `GetBucketRegion` with `DefaultRegion` as the hint. Credentials are used from
+// the configuration if set.
+func GetRegion(ctx aws.Context, config *SessionConfig, bucket string) (string, error) {
+	sess, err := checkSession(config, DefaultRegion)
+	if err != nil {
+		return "", err
+	}
+
+	Log.Debug("Running GetBucketLocation")
+	svc := s3.New(sess)
+	input := &s3.GetBucketLocationInput{
+		Bucket: aws.String(bucket),
+	}
+	if output, err := svc.GetBucketLocationWithContext(ctx, input); err == nil {
+		return s3.NormalizeBucketLocation(aws.StringValue(output.LocationConstraint)), nil
+	}
+
+	Log.Debug("Falling back on GetBucketRegion")
+	region, err := s3manager.GetBucketRegion(ctx, sess, bucket, DefaultRegion)
 	if err != nil {
 		return "", err
 	}
 	return region, nil
 }
 
+var (
+	// lowercase letters, numbers, dots and hyphens, beginning and ending with a letter or number
+	bucketNameExpr = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+	// names formatted as an IP address, ie. 192.168.5.4
+	ipAddressExpr = regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+$`)
+)
+
+// Check if a name follows the S3 naming rules for DNS-compliant buckets, so that names which can't possibly
+// exist are skipped instead of probed:
+//
+// * 3 to 63 characters long, only lowercase letters, numbers, dots and hyphens
+// * begins and ends with a letter or number
+// * no adjacent dots, or dots next to hyphens
+// * not formatted as an IP address
+// * no reserved prefixes or suffixes, ie. `xn--` or `-s3alias`
+func IsValidBucketName(name string) bool {
+	if !bucketNameExpr.MatchString(name) || ipAddressExpr.MatchString(name) {
+		return false
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, ".-") || strings.Contains(name, "-.") {
+		return false
+	}
+	if strings.HasPrefix(name, "xn--") || strings.HasPrefix(name, "sthree-") {
+		return false
+	}
+	if strings.HasSuffix(name, "-s3alias") || strings.HasSuffix(name, "--ol-s3") {
+		return false
+	}
+	return true
+}
+
 // Helper used to check if the current user is authenticated, as some permissions are configured
 // to work only if its by an authenticated user. We won't parse the credentials if it exists, as the
 // S3 SDK should be doing that for us.
 func IsAuthenticated() bool {
-	// resolve standard path to where credentials should be
-	user, _ := user.Current()
-	dir := user.HomeDir
-	path := fmt.Sprintf("%s/.aws/credentials", dir)
-
-	// filepath check
-	log.Println("Checking credentials path exists")
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	return IsAuthenticatedWith(&SessionConfig{})
+}
+
+// Check if sessions for a configuration are authenticated like `IsAuthenticated`, by resolving the
+// credentials they sign requests with. These come from the SDK's default chain, so environment variables,
+// shared files, SSO and process credentials, and ECS task or EC2 instance roles all count.
+func IsAuthenticatedWith(config *SessionConfig) bool {
+	if _, err := resolveCredentials(config); err != nil {
+		Log.Debug("No credentials resolved:", err)
 		return false
 	}
 	return true
 }
 
-// Get the current IAM user's identity metadata, and return ARN
-func GetIAMUserARN(profile string) (string, error) {
-	sess, _ := session.NewSessionWithOptions(session.Options{
-		Profile: profile,
-	})
+// Helper that resolves the credentials sessions for a configuration sign requests with, erroring if there
+// are none, ie. when requests are anonymous.
+func resolveCredentials(config *SessionConfig) (credentials.Value, error) {
+	if config.Anonymous {
+		return credentials.Value{}, errors.New("Requests are sent anonymously.")
+	}
+	sess, err := config.NewSession(DefaultRegion)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	return sess.Config.Credentials.Get()
+}
 
-	log.Println("Running GetCallerIdentity to parse ARN")
+// Get the current IAM user's identity metadata, and return ARN. If a role was assumed, this is the
+// assumed role's ARN instead.
+func GetIAMUserARN(config *SessionConfig) (string, error) {
+	sess, err := config.NewSession(DefaultRegion)
+	if err != nil {
+		return "", err
+	}
+
+	Log.Debug("Running GetCallerIdentity to parse ARN")
 	svc := sts.New(sess)
 	input := &sts.GetCallerIdentityInput{}
 	result, err := svc.GetCallerIdentity(input)
@@ -56,39 +363,123 @@ func GetIAMUserARN(profile string) (string, error) {
 	return *result.Arn, nil
 }
 
-// Given a profile, parse out all accessible buckets, if possible
-func ListBuckets(profile string) (*[]string, error) {
-	sess, _ := session.NewSessionWithOptions(session.Options{
-		Profile: profile,
-		Config: aws.Config{
-			Region: aws.String("us-east-2"), // TODO: figure out beforehand
-		},
-	})
+// Region used for global operations such as `ListBuckets`, which is always available in the standard partition
+const GlobalRegion = "us-east-1"
+
+// Given a session configuration, parse out all accessible buckets, if possible
+func ListBuckets(config *SessionConfig) (*[]string, error) {
+	// listing buckets is global, so use the default region, which is the stable global endpoint unless changed
+	sess, err := config.NewSession(DefaultRegion)
+	if err != nil {
+		return nil, err
+	}
 	svc := s3.New(sess)
 
 	// retrieve buckets and error handle
-	log.Println("Running ListBucket")
+	Log.Debug("Running ListBucket")
 	input := &s3.ListBucketsInput{}
 	result, err := svc.ListBuckets(input)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Could not list buckets for the current IAM principal: %v", err)
 	}
 
 	// iterate over results and save to list to return
-	log.Println("Parsing out bucket names to return")
+	Log.Debug("Parsing out bucket names to return")
 	buckets := []string{}
 	for _, entry := range result.Buckets {
-		buckets = append(buckets, *entry.Name)
+		if entry.Name != nil {
+			buckets = append(buckets, *entry.Name)
+		}
 	}
 	return &buckets, nil
 }
 
-// Does a single `HeadBucket` operation against a target bucket given a name and region.
-func HeadBucket(target string, region string) bool {
+// Helper that parses out the AWS error code from an error returned by the SDK, if any.
+func ErrorCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return ""
+}
+
+// Outcome of a `HeadBucket` operation, so callers can react differently to throttling and region problems
+// instead of treating every failure as a missing bucket.
+type HeadStatus int
+
+const (
+	// bucket exists, even if access to it was denied
+	HeadExists HeadStatus = iota
+
+	// bucket doesn't exist, or the error couldn't be attributed to anything else
+	HeadNotFound
+
+	// requests kept getting throttled even after retrying, so existence is unknown
+	HeadThrottled
+
+	// the region couldn't be resolved or the bucket lives in another region, so other regions should be tried
+	HeadWrongRegion
+)
+
+// Error codes returned when a request is denied, rather than the bucket being missing
+var deniedCodes = map[string]bool{
+	"Forbidden":    true,
+	"AccessDenied": true,
+}
+
+// Error codes returned when S3 is throttling requests
+var throttleCodes = map[string]bool{
+	"SlowDown":             true,
+	"RequestLimitExceeded": true,
+	"Throttling":           true,
+	"ThrottlingException":  true,
+}
+
+// Error codes returned when a request was sent to the wrong region, or no region could be resolved
+var regionCodes = map[string]bool{
+	"MissingEndpoint":              true,
+	"MissingRegion":                true,
+	"BucketRegionError":            true,
+	"PermanentRedirect":            true,
+	"AuthorizationHeaderMalformed": true,
+}
+
+// Classify the error returned by a `HeadBucket` operation in a region.
+func ClassifyHeadError(err error, region string) HeadStatus {
+	if err == nil {
+		return HeadExists
+	}
+
+	code := ErrorCode(err)
+	switch {
+	// AccessDenied means bucket exists, unless in China or GovCloud regions, which report that for all
+	case code == "Forbidden" && !IsIsolatedRegion(region):
+		return HeadExists
+
+	// InvalidKey means bucket exists but points to a deleted object
+	case code == s3.ErrCodeNoSuchKey:
+		return HeadExists
+
+	case throttleCodes[code]:
+		return HeadThrottled
+
+	case regionCodes[code]:
+		return HeadWrongRegion
+	}
+
+	// anything else, such as InvalidBucket
+	return HeadNotFound
+}
+
+// Does a `HeadBucket` operation against a target bucket given a name and region, classifying the result.
+// Throttled requests are retried with exponential backoff up to `MaxRetries` times, on top of the retries
+// done by the SDK, unless the context is cancelled while waiting. The underlying error is also returned, as a
+// bucket may exist but still deny access.
+func HeadBucketStatus(ctx aws.Context, config *SessionConfig, target string, region string) (HeadStatus, error) {
 	// configure session to work in specific region
-	sess, _ := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
+	sess, err := checkSession(config, region)
+	if err != nil {
+		return ClassifyHeadError(err, region), err
+	}
 	svc := s3.New(sess)
 
 	// create new wrapped input for the specific operation
@@ -96,51 +487,277 @@ func HeadBucket(target string, region string) bool {
 		Bucket: aws.String(target),
 	}
 
-	// check to see if URL bucket exists
-	log.Println("Running HeadBucket")
-	_, err := svc.HeadBucket(input)
-	if err != nil {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		Log.Debug("Running HeadBucket")
+		_, err = svc.HeadBucketWithContext(ctx, input)
+		status := ClassifyHeadError(err, region)
+		if status != HeadThrottled || attempt >= MaxRetries {
+			if status == HeadThrottled {
+				Log.Warnf("Still throttled after %d retries checking %s\n", MaxRetries, target)
+			}
+			return status, err
+		}
 
-		// if AccessDenied or InvalidKey, the bucket exists but may lack permissiosn
-		// to access it, requiring further investigation (TODO: ErrCodeNoSuchUpload)
-		if aerr, ok := err.(awserr.Error); ok {
-			errMsg := aerr.Code()
+		Log.Debugf("Throttled checking %s, retrying in %s\n", target, backoff)
+		if err := aws.SleepWithContext(ctx, backoff); err != nil {
+			return status, err
+		}
+		backoff *= 2
+	}
+}
 
-			log.Println("Parsing error message to properly return response")
+// Does a single `HeadBucket` operation with a client, also returning the region S3 reports the bucket is in,
+// which it sends even when the request was made against the wrong region.
+func HeadBucketRegion(ctx aws.Context, svc s3.S3, bucket string) (string, error) {
+	req, _ := svc.HeadBucketRequest(&s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	req.SetContext(ctx)
+	err := req.Send()
 
-			// AccessDenied means bucket exists, unless in China region, which reports that for all
-			if (errMsg == "Forbidden") && (region != "cn-north-1") && (region != "cn-northwest-1") {
-				return true
+	region := ""
+	if req.HTTPResponse != nil {
+		region = req.HTTPResponse.Header.Get("X-Amz-Bucket-Region")
+	}
+	return region, err
+}
 
-				// InvalidKey means bucket exists but points to a deleted object
-			} else if errMsg == s3.ErrCodeNoSuchKey {
-				return true
+// Does a single `HeadBucket` operation against a target bucket given a name and region, only reporting whether
+// the bucket was found in the region. The underlying error is also returned, as a bucket may exist but still
+// deny access, ie. with a `Forbidden` code.
+func HeadBucket(ctx aws.Context, config *SessionConfig, target string, region string) (bool, error) {
+	status, err := HeadBucketStatus(ctx, config, target, region)
+	return status == HeadExists, err
+}
 
-				// missing* may be a s3 specific error, possible latency issues
-			} else if (errMsg == "MissingEndpoint") || (errMsg == "MissingRegion") {
-				log.Println("May be encountering a rate limit/timeout.")
-				return false
+// Helper that checks if a bucket exists within any of the given regions, only probing those instead of
+// discovering the region. Returns the first region the bucket was found in. If no regions are given,
+// falls back on discovering the region.
+func CheckBucketExistsIn(ctx aws.Context, config *SessionConfig, target string, regions []string) (bool, string, error) {
+	if len(regions) == 0 {
+		return CheckBucketExists(ctx, config, target, NoRegion)
+	}
 
-				// anything else, such as InvalidBucket
-			} else {
-				return false
-			}
+	var lastErr error
+	for _, region := range regions {
+		Log.Debugf("Probing for bucket in %s\n", region)
+		exists, err := HeadBucket(ctx, config, target, region)
+		if exists {
+			return true, region, err
 		}
+		lastErr = err
 	}
-	return true
+	return false, "", lastErr
 }
 
-// Helper that checks if a bucket exists within a region, returning the status and region name.
-// If no region is specified, the supported list of AWS regions will be checked and returned.
-func CheckBucketExists(target string, region string) (bool, string) {
+// Helper that checks if a bucket exists within a region, returning the status and region name, alongside
+// the underlying error encountered, if any. If no region is specified, the supported list of AWS regions
+// will be checked and returned.
+func CheckBucketExists(ctx aws.Context, config *SessionConfig, target string, region string) (bool, string, error) {
 	// if no region specified, try to figure it out and return
 	if region == NoRegion || region == "" {
-		log.Println("Attempting to figure out region for bucket")
-		newRegion, err := GetRegion(target)
-		if err != nil {
-			return false, ""
+		Log.Debug("Attempting to figure out region for bucket")
+		newRegion, err := GetRegion(ctx, config, target)
+		if err == nil {
+			return true, newRegion, nil
+		}
+
+		// only a denied region lookup is worth probing each region for, as the bucket may still allow
+		// `HeadBucket`. Anything else, ie. a missing bucket or network failure, would fail in every region too.
+		if !deniedCodes[ErrorCode(err)] {
+			return false, "", err
+		}
+		Log.Debugf("Region lookup denied (%v), probing all regions\n", err)
+		if exists, anyRegion := HeadBucketAnyRegion(ctx, config, target); exists {
+			return true, anyRegion, nil
 		}
-		return true, newRegion
+		return false, "", err
 	}
-	return HeadBucket(target, region), region
+	status, err := HeadBucketStatus(ctx, config, target, region)
+	if status == HeadWrongRegion {
+		// the region given was wrong or unusable, so discover where the bucket actually is
+		Log.Debugf("Bucket not reachable in %s (%v), discovering its region\n", region, err)
+		return CheckBucketExists(ctx, config, target, NoRegion)
+	}
+	return status == HeadExists, region, err
+}
+
+// Fans out a `HeadBucket` across every region in the standard AWS partition concurrently, returning the first
+// region the bucket was found in. Used for buckets that deny `GetBucketLocation` and `GetBucketRegion`, but can
+// still be probed per-region.
+func HeadBucketAnyRegion(ctx aws.Context, config *SessionConfig, target string) (bool, string) {
+	regions := endpoints.AwsPartition().Regions()
+
+	// buffered so that probes still running after a match don't block forever
+	found := make(chan string, len(regions))
+	var wg sync.WaitGroup
+	for id := range regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			if exists, _ := HeadBucket(ctx, config, target, region); exists {
+				found <- region
+			}
+		}(id)
+	}
+
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	if region, ok := <-found; ok {
+		return true, region
+	}
+	return false, ""
+}
+
+// Create a bucket in a region with the given credentials, ie. to demonstrate a bucket takeover during an
+// authorized engagement. This creates a real resource in the account that must be cleaned up afterwards.
+func ClaimBucket(config *SessionConfig, bucket string, region string) error {
+	if config == nil || config.Anonymous {
+		return errors.New("Claiming a bucket requires credentials for the account it will be created in.")
+	}
+	if region == "" || region == NoRegion {
+		region = DefaultRegion
+	}
+
+	sess, err := config.NewSession(region)
+	if err != nil {
+		return err
+	}
+	svc := s3.New(sess)
+
+	// us-east-1 is the default location, and is rejected if given as a constraint
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+	}
+	if region != GlobalRegion {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(region),
+		}
+	}
+
+	Log.Warnf("Running CreateBucket to claim %s in %s\n", bucket, region)
+	if _, err := svc.CreateBucket(input); err != nil {
+		return fmt.Errorf("Could not claim bucket %s: %v", bucket, err)
+	}
+	return nil
+}
+
+// Cheaply check if a bucket name could exist by resolving `<name>.s3.amazonaws.com`, only returning false if
+// the name doesn't resolve at all. DNS isn't authoritative for every region, so this should only be used to
+// skip clearly dead names, never to confirm a bucket exists.
+func BucketExistsDNS(name string) bool {
+	_, err := net.LookupHost(name + ".s3.amazonaws.com")
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return false
+	}
+	return true
+}
+
+// Check if S3 considers a bucket public based on its policy status.
+func IsBucketPublic(ctx aws.Context, svc s3.S3, bucket string) (bool, error) {
+	Log.Debug("Running GetBucketPolicyStatus")
+	input := &s3.GetBucketPolicyStatusInput{
+		Bucket: aws.String(bucket),
+	}
+	output, err := svc.GetBucketPolicyStatusWithContext(ctx, input)
+	if err != nil {
+		return false, err
+	}
+	if output.PolicyStatus == nil {
+		return false, nil
+	}
+	return aws.BoolValue(output.PolicyStatus.IsPublic), nil
+}
+
+// List up to a number of object keys from a bucket, optionally under a prefix, for a quick look at what a
+// listable bucket holds. Keys listed before an error are still returned.
+func SampleObjects(ctx aws.Context, svc s3.S3, bucket string, prefix string, max int) []string {
+	Log.Debug("Running ListObjectsV2 to sample objects")
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		MaxKeys: aws.Int64(int64(max)),
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	keys := []string{}
+	svc.ListObjectsV2PagesWithContext(ctx, input, func(output *s3.ListObjectsV2Output, last bool) bool {
+		for _, object := range output.Contents {
+			if len(keys) >= max {
+				return false
+			}
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return len(keys) < max
+	})
+	return keys
+}
+
+// Regions whose website endpoints are `s3-website-<REGION>` rather than `s3-website.<REGION>`, as in newer regions
+var dashWebsiteRegions = map[string]bool{
+	"us-east-1":      true,
+	"us-west-1":      true,
+	"us-west-2":      true,
+	"ap-southeast-1": true,
+	"ap-southeast-2": true,
+	"ap-northeast-1": true,
+	"eu-west-1":      true,
+	"sa-east-1":      true,
+	"us-gov-west-1":  true,
+}
+
+// Get the URL a bucket configured as a static website is served from in a region.
+func WebsiteEndpoint(bucket string, region string) string {
+	if dashWebsiteRegions[region] {
+		return fmt.Sprintf("http://%s.s3-website-%s.amazonaws.com", bucket, region)
+	}
+	return fmt.Sprintf("http://%s.s3-website.%s.amazonaws.com", bucket, region)
+}
+
+// Fetch a website endpoint's index document anonymously, returning if it's publicly serving content.
+func IsWebsiteServing(ctx aws.Context, endpoint string) (bool, error) {
+	Log.Debugf("Fetching index document from %s\n", endpoint)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint+"/", nil)
+	if err != nil {
+		return false, err
+	}
+	if UserAgent != "" {
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	resp, err := NewHTTPClient(0).Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// Estimate how many objects a bucket holds under a prefix, if any, and their total size in bytes by paginating
+// through its listing until the context is cancelled, stopping after a maximum number of pages of up to 1000
+// objects each, so the estimate is a lower bound for large buckets.
+func EstimateBucketSize(ctx aws.Context, svc s3.S3, bucket string, prefix string, maxPages int) (int64, int64) {
+	Log.Debug("Running ListObjectsV2 to estimate bucket size")
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+
+	var count, size int64
+	pages := 0
+	svc.ListObjectsV2PagesWithContext(ctx, input, func(output *s3.ListObjectsV2Output, last bool) bool {
+		for _, object := range output.Contents {
+			count += 1
+			size += aws.Int64Value(object.Size)
+		}
+		pages += 1
+		return pages < maxPages
+	})
+	return count, size
 }
@@ -0,0 +1,248 @@
+package slamdunk
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestIsValidBucketName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{"2 characters", "ab", false},
+		{"3 characters", "abc", true},
+		{"63 characters", strings.Repeat("a", 63), true},
+		{"64 characters", strings.Repeat("a", 64), false},
+		{"dots and hyphens", "my-bucket.example.com", true},
+		{"adjacent dots", "my..bucket", false},
+		{"dot before hyphen", "my.-bucket", false},
+		{"hyphen before dot", "my-.bucket", false},
+		{"leading hyphen", "-bucket", false},
+		{"trailing dot", "bucket.", false},
+		{"uppercase", "MyBucket", false},
+		{"underscore", "my_bucket", false},
+		{"ip address", "192.168.5.4", false},
+		{"ip-like with letters", "192.168.5.a4", true},
+		{"xn-- prefix", "xn--bucket", false},
+		{"sthree- prefix", "sthree-bucket", false},
+		{"-s3alias suffix", "bucket-s3alias", false},
+		{"--ol-s3 suffix", "bucket--ol-s3", false},
+	}
+	for _, test := range tests {
+		if got := IsValidBucketName(test.input); got != test.want {
+			t.Errorf("%s: IsValidBucketName(%q) = %t, want %t", test.name, test.input, got, test.want)
+		}
+	}
+}
+
+// Helper that sets environment variables for the rest of a test, restoring them once it's done.
+func setenv(t *testing.T, vars map[string]string) {
+	for key, value := range vars {
+		previous, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, previous)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+}
+
+// Helper that isolates a test from whatever credentials the machine running it has, returning an empty
+// home directory to write shared files into.
+func isolateCredentials(t *testing.T) string {
+	home, err := ioutil.TempDir("", "slamdunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(home) })
+
+	setenv(t, map[string]string{
+		"HOME":                        home,
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+		"AWS_SESSION_TOKEN":           "",
+		"AWS_PROFILE":                 "",
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(home, "credentials"),
+		"AWS_CONFIG_FILE":             filepath.Join(home, "config"),
+		"AWS_EC2_METADATA_DISABLED":   "true",
+
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI":     "",
+		"AWS_WEB_IDENTITY_TOKEN_FILE":            "",
+	})
+	return home
+}
+
+// Credentials are resolved from wherever the SDK finds them, not only the environment or credentials file.
+func TestIsAuthenticatedWith(t *testing.T) {
+	home := isolateCredentials(t)
+	if IsAuthenticatedWith(&SessionConfig{}) {
+		t.Errorf("authenticated without any credentials available")
+	}
+
+	// a profile only defined in the config file, like SSO or process credentials, with no credentials file
+	script := filepath.Join(home, "credentials.sh")
+	output := `#!/bin/sh
+echo '{"Version": 1, "AccessKeyId": "AKIDEXAMPLE", "SecretAccessKey": "secret"}'
+`
+	if err := ioutil.WriteFile(script, []byte(output), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(home, "config")
+	if err := ioutil.WriteFile(config, []byte("[profile ci]\ncredential_process = "+script+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !IsAuthenticatedWith(&SessionConfig{Profile: "ci", ConfigFile: config}) {
+		t.Errorf("not authenticated with process credentials from the config file")
+	}
+	if IsAuthenticatedWith(&SessionConfig{Profile: "ci", ConfigFile: config, Anonymous: true}) {
+		t.Errorf("authenticated while sending requests anonymously")
+	}
+
+	setenv(t, map[string]string{"AWS_ACCESS_KEY_ID": "AKIDEXAMPLE", "AWS_SECRET_ACCESS_KEY": "secret"})
+	if !IsAuthenticatedWith(&SessionConfig{}) {
+		t.Errorf("not authenticated with credentials in the environment")
+	}
+}
+
+// Helper that creates a S3 client sending every request to a test server instead of AWS.
+func testS3(t *testing.T, handler http.HandlerFunc) *s3.S3 {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", ""),
+		MaxRetries:       aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3.New(withHandlers(sess))
+}
+
+func TestEstimateBucketSize(t *testing.T) {
+	prefixes := []string{}
+	svc := testS3(t, func(w http.ResponseWriter, req *http.Request) {
+		prefixes = append(prefixes, req.URL.Query().Get("prefix"))
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<ListBucketResult><Name>bucket</Name><IsTruncated>true</IsTruncated>
+<NextContinuationToken>next</NextContinuationToken><Contents><Key>logs/a.txt</Key><Size>10</Size></Contents></ListBucketResult>`))
+	})
+
+	count, size := EstimateBucketSize(context.Background(), *svc, "bucket", "logs/", 3)
+	if count != 3 || size != 30 {
+		t.Errorf("estimated %d objects and %d bytes, want 3 and 30 from 3 pages", count, size)
+	}
+	for _, prefix := range prefixes {
+		if prefix != "logs/" {
+			t.Errorf("listed with prefix %q, want logs/", prefix)
+		}
+	}
+
+	// stops listing once cancelled, ie. on a timeout or interrupt
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if count, _ := EstimateBucketSize(ctx, *svc, "bucket", "", 3); count != 0 {
+		t.Errorf("estimated %d objects after being cancelled, want 0", count)
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	SetRateLimit(1)
+	t.Cleanup(func() { SetRateLimit(0) })
+
+	svc := testS3(t, func(w http.ResponseWriter, req *http.Request) {})
+	input := &s3.HeadBucketInput{Bucket: aws.String("bucket")}
+	if _, err := svc.HeadBucket(input); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next request has to wait a second, so it gives up once its context is cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := svc.HeadBucketWithContext(ctx, input); ErrorCode(err) != request.CanceledErrorCode {
+		t.Errorf("rate limited request returned %v, want it cancelled", err)
+	}
+
+	// removing the limit also applies to sessions that were already created
+	SetRateLimit(0)
+	done := make(chan error, 1)
+	go func() {
+		_, err := svc.HeadBucket(input)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("request still rate limited after removing the limit")
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHeadBucketStatusCancelled(t *testing.T) {
+	isolateCredentials(t)
+
+	// a custom CA bundle can only be loaded into an `http.Transport`
+	setenv(t, map[string]string{"AWS_CA_BUNDLE": ""})
+
+	retries := MaxRetries
+	MaxRetries = 1
+	defer func() { MaxRetries = retries }()
+
+	// every request is throttled, and the run is cancelled once the SDK has given up retrying
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests := 0
+	original := transport
+	transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		if requests > MaxRetries {
+			cancel()
+		}
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader("<Error><Code>SlowDown</Code></Error>")),
+			Request:    req,
+		}, nil
+	})
+	defer func() { transport = original }()
+
+	status, err := HeadBucketStatus(ctx, &SessionConfig{Anonymous: true}, "bucket", "us-east-1")
+	if status != HeadThrottled || err != context.Canceled {
+		t.Errorf("cancelled check returned %v, %v, want throttled and cancelled", status, err)
+	}
+	if requests != MaxRetries+1 {
+		t.Errorf("sent %d requests, want %d as the backoff should stop once cancelled", requests, MaxRetries+1)
+	}
+}
@@ -0,0 +1,158 @@
+package slamdunk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+const (
+	SarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	SarifVersion = "2.1.0"
+)
+
+// Top-level SARIF document, only implementing the parts of the spec we need for reporting findings
+type SarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SarifRun `json:"runs"`
+}
+
+type SarifRun struct {
+	Tool    SarifTool     `json:"tool"`
+	Results []SarifResult `json:"results"`
+}
+
+type SarifTool struct {
+	Driver SarifDriver `json:"driver"`
+}
+
+type SarifDriver struct {
+	Name           string      `json:"name"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []SarifRule `json:"rules"`
+}
+
+// Each action in the playbook is represented as a rule
+type SarifRule struct {
+	Id               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription SarifMessage `json:"shortDescription"`
+	Help             SarifMessage `json:"help"`
+}
+
+// Each permission granted on a bucket is represented as a result
+type SarifResult struct {
+	RuleId    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   SarifMessage    `json:"message"`
+	Locations []SarifLocation `json:"locations"`
+}
+
+type SarifMessage struct {
+	Text string `json:"text"`
+}
+
+type SarifLocation struct {
+	PhysicalLocation SarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type SarifPhysicalLocation struct {
+	ArtifactLocation SarifArtifactLocation `json:"artifactLocation"`
+}
+
+type SarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+// Helper that generates the rule ID for an action
+func sarifRuleId(action string) string {
+	return "slamdunk/" + action
+}
+
+// Map an audit into a SARIF document, where only permissions granted on a bucket produce results.
+// Write permissions are reported as errors, while read permissions are reported as warnings.
+func NewSarifLog(audit Audit) *SarifLog {
+	playbook := NewPlayBook()
+
+	// sort for stable output between runs
+	names := []string{}
+	for name := range playbook {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rules := []SarifRule{}
+	for _, name := range names {
+		action := playbook[name]
+		rules = append(rules, SarifRule{
+			Id:               sarifRuleId(name),
+			Name:             name,
+			ShortDescription: SarifMessage{Text: action.Description},
+			Help:             SarifMessage{Text: "aws s3api " + action.Cmd},
+		})
+	}
+
+	buckets := []string{}
+	for bucket := range audit {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+
+	results := []SarifResult{}
+	for _, bucket := range buckets {
+		perms := []string{}
+		for perm, result := range audit[bucket] {
+			if result {
+				perms = append(perms, perm)
+			}
+		}
+		sort.Strings(perms)
+
+		for _, perm := range perms {
+			level := "warning"
+			if IsWriteAction(perm) {
+				level = "error"
+			}
+			results = append(results, SarifResult{
+				RuleId:  sarifRuleId(perm),
+				Level:   level,
+				Message: SarifMessage{Text: fmt.Sprintf("%s is allowed on bucket %s", perm, bucket)},
+				Locations: []SarifLocation{
+					{
+						PhysicalLocation: SarifPhysicalLocation{
+							ArtifactLocation: SarifArtifactLocation{Uri: "s3://" + bucket},
+						},
+					},
+				},
+			})
+		}
+	}
+
+	return &SarifLog{
+		Schema:  SarifSchema,
+		Version: SarifVersion,
+		Runs: []SarifRun{
+			{
+				Tool: SarifTool{
+					Driver: SarifDriver{
+						Name:           "slamdunk",
+						InformationUri: "https://github.com/ex0dus-0x/slamdunk",
+						Rules:          rules,
+					},
+				},
+				Results: results,
+			},
+		},
+	}
+}
+
+// Write the results for all buckets analyzed as a SARIF document to a filepath.
+func (a *Auditor) OutputSARIF(path string) error {
+	data, err := json.MarshalIndent(NewSarifLog(a.Snapshot()), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}